@@ -2,33 +2,21 @@ package main
 
 import (
 	"bufio"
+	"context"
 	"encoding/json"
 	"flag"
 	"fmt"
 	"io"
+	"log/slog"
 	"os"
+
+	"github.com/manaflow-ai/cmux/daemon/remote/jsonrpc2"
+	"github.com/manaflow-ai/cmux/daemon/remote/proxy"
+	"github.com/manaflow-ai/cmux/daemon/remote/session"
 )
 
 var version = "dev"
 
-type rpcRequest struct {
-	ID     any            `json:"id"`
-	Method string         `json:"method"`
-	Params map[string]any `json:"params"`
-}
-
-type rpcError struct {
-	Code    string `json:"code"`
-	Message string `json:"message"`
-}
-
-type rpcResponse struct {
-	ID     any       `json:"id,omitempty"`
-	OK     bool      `json:"ok"`
-	Result any       `json:"result,omitempty"`
-	Error  *rpcError `json:"error,omitempty"`
-}
-
 func main() {
 	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
 }
@@ -47,6 +35,13 @@ func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
 		fs := flag.NewFlagSet("serve", flag.ContinueOnError)
 		fs.SetOutput(stderr)
 		stdio := fs.Bool("stdio", false, "serve over stdin/stdout")
+		framing := fs.String("framing", "newline", "wire framing: \"newline\" (line-delimited JSON, default) or \"headers\" (LSP-style Content-Length framing)")
+		legacyEnvelope := fs.Bool("legacy-envelope", false, "speak the pre-2.0 {id,method,params}/{ok,result,error} envelope instead of JSON-RPC 2.0")
+		httpConnectUpstream := fs.String("http-connect-upstream", "", "upstream HTTP proxy (host:port) backing proxy.http_connect")
+		socks5Upstream := fs.String("socks5-upstream", "", "upstream SOCKS5 proxy (host:port) backing proxy.socks5")
+		sessionOutputBuffer := fs.Int("session-output-buffer", 0, "bytes buffered per session.basic session before the pump applies backpressure (0 uses the default)")
+		otlpEndpoint := fs.String("otlp-endpoint", "", "OTLP/gRPC collector endpoint (host:port) for RPC traces and metrics")
+		logFormat := fs.String("log-format", "", "structured per-call log format: \"\" (disabled) or \"json\"")
 		if err := fs.Parse(args[1:]); err != nil {
 			return 2
 		}
@@ -54,7 +49,32 @@ func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
 			_, _ = fmt.Fprintln(stderr, "serve requires --stdio")
 			return 2
 		}
-		if err := runStdioServer(stdin, stdout); err != nil {
+
+		ctx := context.Background()
+		shutdownTelemetry, err := setupTelemetry(ctx, *otlpEndpoint)
+		if err != nil {
+			_, _ = fmt.Fprintf(stderr, "serve failed: %v\n", err)
+			return 1
+		}
+		defer shutdownTelemetry(ctx)
+
+		logger, err := setupLogger(*logFormat, stderr)
+		if err != nil {
+			_, _ = fmt.Fprintf(stderr, "serve failed: %v\n", err)
+			return 1
+		}
+
+		if *legacyEnvelope {
+			err = runLegacyStdioServer(stdin, stdout)
+		} else {
+			err = runStdioServer(stdin, stdout, *framing, proxy.Config{
+				HTTPConnectUpstream: *httpConnectUpstream,
+				SOCKS5Upstream:      *socks5Upstream,
+			}, session.Config{
+				OutputBufferSize: *sessionOutputBuffer,
+			}, logger)
+		}
+		if err != nil {
 			_, _ = fmt.Fprintf(stderr, "serve failed: %v\n", err)
 			return 1
 		}
@@ -68,10 +88,95 @@ func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
 func usage(w io.Writer) {
 	_, _ = fmt.Fprintln(w, "Usage:")
 	_, _ = fmt.Fprintln(w, "  cmuxd-remote version")
-	_, _ = fmt.Fprintln(w, "  cmuxd-remote serve --stdio")
+	_, _ = fmt.Fprintln(w, "  cmuxd-remote serve --stdio [--framing newline|headers] [--legacy-envelope] [--otlp-endpoint host:port] [--log-format json]")
+}
+
+// runStdioServer serves JSON-RPC 2.0 requests over stdin/stdout using the
+// wire framing named by framing ("newline" or "headers"; see
+// jsonrpc2.NewNewlineStream and jsonrpc2.NewHeaderStream). It uses the
+// bidirectional Conn so that the session.* and proxy.* handlers can push
+// notifications back to the client (e.g. session.output, proxy.data).
+func runStdioServer(stdin io.Reader, stdout io.Writer, framing string, proxyCfg proxy.Config, sessionCfg session.Config, logger *slog.Logger) error {
+	stream, err := newStdioStream(framing, stdin, stdout)
+	if err != nil {
+		return err
+	}
+
+	mux := newMux()
+	conn := jsonrpc2.NewConnStream(stream, mux)
+	conn.Logger = logger
+	proxy.NewManager(proxyCfg, conn).Register(mux)
+	session.NewManager(sessionCfg, conn).Register(mux)
+
+	err = conn.Run(context.Background())
+	if err == io.EOF {
+		return nil
+	}
+	return err
+}
+
+// newStdioStream builds the jsonrpc2.Stream named by framing.
+func newStdioStream(framing string, r io.Reader, w io.Writer) (jsonrpc2.Stream, error) {
+	switch framing {
+	case "", "newline":
+		return jsonrpc2.NewNewlineStream(r, w), nil
+	case "headers":
+		return jsonrpc2.NewHeaderStream(r, w), nil
+	default:
+		return nil, fmt.Errorf("unsupported --framing %q (want \"newline\" or \"headers\")", framing)
+	}
 }
 
-func runStdioServer(stdin io.Reader, stdout io.Writer) error {
+// newMux registers the RPC methods this daemon supports, other than the
+// proxy.* and session.* methods, which are registered separately once a
+// Conn exists to back their server-initiated notifications.
+func newMux() *jsonrpc2.Mux {
+	mux := jsonrpc2.NewMux()
+	mux.RegisterFunc("hello", handleHello)
+	mux.RegisterFunc("ping", handlePing)
+	return mux
+}
+
+func handleHello(ctx context.Context, req *jsonrpc2.Request) (any, error) {
+	return map[string]any{
+		"name":    "cmuxd-remote",
+		"version": version,
+		"capabilities": []string{
+			"session.basic",
+			"proxy.http_connect",
+			"proxy.socks5",
+		},
+	}, nil
+}
+
+func handlePing(ctx context.Context, req *jsonrpc2.Request) (any, error) {
+	return map[string]any{"pong": true}, nil
+}
+
+// --- legacy envelope, kept for one release behind --legacy-envelope ---
+
+type legacyRequest struct {
+	ID     any            `json:"id"`
+	Method string         `json:"method"`
+	Params map[string]any `json:"params"`
+}
+
+type legacyError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+type legacyResponse struct {
+	ID     any          `json:"id,omitempty"`
+	OK     bool         `json:"ok"`
+	Result any          `json:"result,omitempty"`
+	Error  *legacyError `json:"error,omitempty"`
+}
+
+// runLegacyStdioServer serves the pre-2.0 {id,method,params}/{ok,result,error}
+// envelope. Deprecated: will be removed once clients have migrated to
+// JSON-RPC 2.0.
+func runLegacyStdioServer(stdin io.Reader, stdout io.Writer) error {
 	scanner := bufio.NewScanner(stdin)
 	writer := bufio.NewWriter(stdout)
 	defer writer.Flush()
@@ -82,11 +187,11 @@ func runStdioServer(stdin io.Reader, stdout io.Writer) error {
 			continue
 		}
 
-		var req rpcRequest
+		var req legacyRequest
 		if err := json.Unmarshal(line, &req); err != nil {
-			if err := writeResponse(writer, rpcResponse{
+			if err := writeLegacyResponse(writer, legacyResponse{
 				OK: false,
-				Error: &rpcError{
+				Error: &legacyError{
 					Code:    "invalid_request",
 					Message: "invalid JSON request",
 				},
@@ -96,19 +201,16 @@ func runStdioServer(stdin io.Reader, stdout io.Writer) error {
 			continue
 		}
 
-		resp := handleRequest(req)
-		if err := writeResponse(writer, resp); err != nil {
+		resp := handleLegacyRequest(req)
+		if err := writeLegacyResponse(writer, resp); err != nil {
 			return err
 		}
 	}
 
-	if err := scanner.Err(); err != nil {
-		return err
-	}
-	return nil
+	return scanner.Err()
 }
 
-func writeResponse(w *bufio.Writer, resp rpcResponse) error {
+func writeLegacyResponse(w *bufio.Writer, resp legacyResponse) error {
 	payload, err := json.Marshal(resp)
 	if err != nil {
 		return err
@@ -122,12 +224,12 @@ func writeResponse(w *bufio.Writer, resp rpcResponse) error {
 	return w.Flush()
 }
 
-func handleRequest(req rpcRequest) rpcResponse {
+func handleLegacyRequest(req legacyRequest) legacyResponse {
 	if req.Method == "" {
-		return rpcResponse{
+		return legacyResponse{
 			ID: req.ID,
 			OK: false,
-			Error: &rpcError{
+			Error: &legacyError{
 				Code:    "invalid_request",
 				Message: "method is required",
 			},
@@ -136,7 +238,7 @@ func handleRequest(req rpcRequest) rpcResponse {
 
 	switch req.Method {
 	case "hello":
-		return rpcResponse{
+		return legacyResponse{
 			ID: req.ID,
 			OK: true,
 			Result: map[string]any{
@@ -150,7 +252,7 @@ func handleRequest(req rpcRequest) rpcResponse {
 			},
 		}
 	case "ping":
-		return rpcResponse{
+		return legacyResponse{
 			ID: req.ID,
 			OK: true,
 			Result: map[string]any{
@@ -158,10 +260,10 @@ func handleRequest(req rpcRequest) rpcResponse {
 			},
 		}
 	default:
-		return rpcResponse{
+		return legacyResponse{
 			ID: req.ID,
 			OK: false,
-			Error: &rpcError{
+			Error: &legacyError{
 				Code:    "method_not_found",
 				Message: fmt.Sprintf("unknown method %q", req.Method),
 			},
@@ -3,6 +3,7 @@ package main
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
 	"strings"
 	"testing"
 )
@@ -20,8 +21,8 @@ func TestRunVersion(t *testing.T) {
 
 func TestRunStdioHelloAndPing(t *testing.T) {
 	input := strings.NewReader(
-		`{"id":1,"method":"hello","params":{}}` + "\n" +
-			`{"id":2,"method":"ping","params":{}}` + "\n",
+		`{"jsonrpc":"2.0","id":1,"method":"hello","params":{}}` + "\n" +
+			`{"jsonrpc":"2.0","id":2,"method":"ping","params":{}}` + "\n",
 	)
 	var out bytes.Buffer
 	code := run([]string{"serve", "--stdio"}, input, &out, &bytes.Buffer{})
@@ -34,27 +35,103 @@ func TestRunStdioHelloAndPing(t *testing.T) {
 		t.Fatalf("got %d response lines, want 2: %q", len(lines), out.String())
 	}
 
-	var first map[string]any
-	if err := json.Unmarshal([]byte(lines[0]), &first); err != nil {
-		t.Fatalf("failed to decode first response: %v", err)
+	// Each request runs in its own dispatch goroutine (see jsonrpc2.Conn),
+	// so the two responses can land in either order; correlate by id
+	// rather than assuming hello's response comes first.
+	byID := make(map[float64]map[string]any, len(lines))
+	for _, line := range lines {
+		var resp map[string]any
+		if err := json.Unmarshal([]byte(line), &resp); err != nil {
+			t.Fatalf("failed to decode response %q: %v", line, err)
+		}
+		if resp["error"] != nil {
+			t.Fatalf("unexpected error response: %v", resp)
+		}
+		id, _ := resp["id"].(float64)
+		byID[id] = resp
 	}
-	if ok, _ := first["ok"].(bool); !ok {
-		t.Fatalf("first response should be ok=true: %v", first)
+
+	hello, ok := byID[1]
+	if !ok {
+		t.Fatalf("missing response for id 1 (hello): %v", byID)
 	}
-	firstResult, _ := first["result"].(map[string]any)
-	if firstResult == nil {
-		t.Fatalf("first response missing result object: %v", first)
+	helloResult, _ := hello["result"].(map[string]any)
+	if helloResult == nil {
+		t.Fatalf("hello response missing result object: %v", hello)
 	}
-	capabilities, _ := firstResult["capabilities"].([]any)
+	capabilities, _ := helloResult["capabilities"].([]any)
 	if len(capabilities) < 2 {
-		t.Fatalf("hello should return capabilities: %v", firstResult)
+		t.Fatalf("hello should return capabilities: %v", helloResult)
+	}
+
+	if _, ok := byID[2]; !ok {
+		t.Fatalf("missing response for id 2 (ping): %v", byID)
+	}
+}
+
+func TestRunStdioLogFormatJSON(t *testing.T) {
+	input := strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"ping","params":{}}` + "\n")
+	var out, errOut bytes.Buffer
+	code := run([]string{"serve", "--stdio", "--log-format=json"}, input, &out, &errOut)
+	if code != 0 {
+		t.Fatalf("run serve exit code = %d, want 0", code)
+	}
+
+	var logLine map[string]any
+	if err := json.Unmarshal([]byte(strings.TrimSpace(errOut.String())), &logLine); err != nil {
+		t.Fatalf("failed to decode log line %q: %v", errOut.String(), err)
+	}
+	if logLine["method"] != "ping" {
+		t.Fatalf("log line missing method=ping: %v", logLine)
+	}
+}
+
+func TestRunStdioFramingHeaders(t *testing.T) {
+	payload := `{"jsonrpc":"2.0","id":1,"method":"ping","params":{}}`
+	input := strings.NewReader(fmt.Sprintf("Content-Length: %d\r\n\r\n%s", len(payload), payload))
+	var out bytes.Buffer
+	code := run([]string{"serve", "--stdio", "--framing=headers"}, input, &out, &bytes.Buffer{})
+	if code != 0 {
+		t.Fatalf("run serve exit code = %d, want 0", code)
+	}
+
+	header, body, ok := strings.Cut(out.String(), "\r\n\r\n")
+	if !ok {
+		t.Fatalf("response missing header/body separator: %q", out.String())
+	}
+	if !strings.Contains(header, "Content-Length:") {
+		t.Fatalf("response header missing Content-Length: %q", header)
+	}
+
+	var resp map[string]any
+	if err := json.Unmarshal([]byte(body), &resp); err != nil {
+		t.Fatalf("failed to decode response body %q: %v", body, err)
+	}
+	if resp["error"] != nil {
+		t.Fatalf("unexpected error: %v", resp)
+	}
+}
+
+func TestRunStdioFramingUnsupported(t *testing.T) {
+	code := run([]string{"serve", "--stdio", "--framing=bogus"}, strings.NewReader(""), &bytes.Buffer{}, &bytes.Buffer{})
+	if code == 0 {
+		t.Fatalf("run serve exit code = 0, want failure for unsupported framing")
+	}
+}
+
+func TestRunStdioLegacyEnvelope(t *testing.T) {
+	input := strings.NewReader(`{"id":1,"method":"ping","params":{}}` + "\n")
+	var out bytes.Buffer
+	code := run([]string{"serve", "--stdio", "--legacy-envelope"}, input, &out, &bytes.Buffer{})
+	if code != 0 {
+		t.Fatalf("run serve exit code = %d, want 0", code)
 	}
 
-	var second map[string]any
-	if err := json.Unmarshal([]byte(lines[1]), &second); err != nil {
-		t.Fatalf("failed to decode second response: %v", err)
+	var resp map[string]any
+	if err := json.Unmarshal([]byte(strings.TrimSpace(out.String())), &resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
 	}
-	if ok, _ := second["ok"].(bool); !ok {
-		t.Fatalf("second response should be ok=true: %v", second)
+	if ok, _ := resp["ok"].(bool); !ok {
+		t.Fatalf("legacy response should be ok=true: %v", resp)
 	}
 }
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// setupTelemetry configures global OpenTelemetry trace and metric
+// providers that export to an OTLP/gRPC collector at endpoint. It returns
+// a shutdown func that flushes and closes both providers; callers should
+// defer it. If endpoint is empty, setupTelemetry is a no-op and the
+// package's tracer/meter remain the default no-op implementations.
+func setupTelemetry(ctx context.Context, endpoint string) (shutdown func(context.Context) error, err error) {
+	if endpoint == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	res := resource.NewSchemaless(attribute.String("service.name", "cmuxd-remote"))
+
+	traceExporter, err := otlptracegrpc.New(ctx,
+		otlptracegrpc.WithEndpoint(endpoint),
+		otlptracegrpc.WithInsecure(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("otlp trace exporter: %w", err)
+	}
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(traceExporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(tp)
+
+	metricExporter, err := otlpmetricgrpc.New(ctx,
+		otlpmetricgrpc.WithEndpoint(endpoint),
+		otlpmetricgrpc.WithInsecure(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("otlp metric exporter: %w", err)
+	}
+	mp := sdkmetric.NewMeterProvider(
+		sdkmetric.WithReader(sdkmetric.NewPeriodicReader(metricExporter)),
+		sdkmetric.WithResource(res),
+	)
+	otel.SetMeterProvider(mp)
+
+	return func(shutdownCtx context.Context) error {
+		tErr := tp.Shutdown(shutdownCtx)
+		mErr := mp.Shutdown(shutdownCtx)
+		if tErr != nil {
+			return tErr
+		}
+		return mErr
+	}, nil
+}
+
+// setupLogger builds the *slog.Logger attached to a Conn when
+// --log-format=json is set, emitting one JSON line per dispatched
+// request. format == "" disables per-call logging.
+func setupLogger(format string, stderr io.Writer) (*slog.Logger, error) {
+	switch format {
+	case "":
+		return nil, nil
+	case "json":
+		return slog.New(slog.NewJSONHandler(stderr, nil)), nil
+	default:
+		return nil, fmt.Errorf("unsupported --log-format %q (want \"json\")", format)
+	}
+}
@@ -0,0 +1,21 @@
+package jsonrpc2
+
+// CancelMethod is the well-known method a peer sends to request
+// cancellation of an in-flight request, mirroring the LSP convention.
+// Params are {"id": <id of the request to cancel>}.
+const CancelMethod = "$/cancelRequest"
+
+// CodeRequestCancelled is returned, also following the LSP convention,
+// when a request's context was cancelled via CancelMethod before its
+// handler finished.
+const CodeRequestCancelled = -32800
+
+// Canceler is an optional interface a Handler may implement to be
+// notified of every $/cancelRequest, with the id it names, in addition to
+// that request's context being cancelled if it is still in flight. Cancel
+// is called whether or not the named request is in flight. This lets handlers
+// that manage resources outside of ctx (e.g. a blocked network dial)
+// react immediately rather than relying solely on ctx.Done().
+type Canceler interface {
+	Cancel(id ID)
+}
@@ -0,0 +1,139 @@
+package jsonrpc2
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestCancelRequest(t *testing.T) {
+	started := make(chan struct{})
+	slowHandler := HandlerFunc(func(ctx context.Context, req *Request) (any, error) {
+		if req.Method != "slow" {
+			return nil, NewError(CodeMethodNotFound, "unknown method")
+		}
+		close(started)
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(10 * time.Second):
+			return "too slow", nil
+		}
+	})
+
+	server, client := pipeConns(t, slowHandler, nil)
+	defer server.closeWith(io.EOF)
+	defer client.closeWith(io.EOF)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	callDone := make(chan error, 1)
+	go func() {
+		callDone <- client.Call(ctx, "slow", nil, nil)
+	}()
+
+	select {
+	case <-started:
+	case <-ctx.Done():
+		t.Fatal("handler never started")
+	}
+
+	if err := client.Notify(ctx, CancelMethod, map[string]any{"id": NewNumberID(1)}); err != nil {
+		t.Fatalf("Notify cancel: %v", err)
+	}
+
+	select {
+	case err := <-callDone:
+		rerr, ok := err.(*Error)
+		if !ok {
+			t.Fatalf("expected *Error, got %T: %v", err, err)
+		}
+		if rerr.Code != CodeRequestCancelled {
+			t.Fatalf("got error code %d, want %d", rerr.Code, CodeRequestCancelled)
+		}
+	case <-ctx.Done():
+		t.Fatal("cancel did not produce a prompt response")
+	}
+}
+
+// TestCancelRequestInBatch is the batch counterpart to TestCancelRequest:
+// a request dispatched as one item of a batch frame must register in
+// c.handling the same way a single-frame request does, so a
+// $/cancelRequest naming it actually cancels the handler instead of
+// silently running to completion.
+func TestCancelRequestInBatch(t *testing.T) {
+	started := make(chan struct{})
+	slowHandler := HandlerFunc(func(ctx context.Context, req *Request) (any, error) {
+		if req.Method != "slow" {
+			return nil, NewError(CodeMethodNotFound, "unknown method")
+		}
+		close(started)
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(10 * time.Second):
+			return "too slow", nil
+		}
+	})
+
+	pr, pw := io.Pipe()
+	var buf bytes.Buffer
+	stream := NewNewlineStream(pr, &buf)
+	conn := NewConnStream(stream, slowHandler)
+
+	done := make(chan error, 1)
+	go func() { done <- conn.Run(context.Background()) }()
+
+	if _, err := io.WriteString(pw, `[{"jsonrpc":"2.0","id":1,"method":"slow"}]`+"\n"); err != nil {
+		t.Fatalf("write batch: %v", err)
+	}
+
+	select {
+	case <-started:
+	case <-time.After(3 * time.Second):
+		t.Fatal("handler never started")
+	}
+
+	cancelReq := &Request{Method: CancelMethod, Params: mustMarshal(t, map[string]any{"id": NewNumberID(1)})}
+	cancelLine, err := json.Marshal(cancelReq)
+	if err != nil {
+		t.Fatalf("marshal cancel request: %v", err)
+	}
+	if _, err := pw.Write(append(cancelLine, '\n')); err != nil {
+		t.Fatalf("write cancel: %v", err)
+	}
+	pw.Close()
+
+	select {
+	case err := <-done:
+		if err != io.EOF {
+			t.Fatalf("Run: %v", err)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("Run never returned")
+	}
+
+	var resps []Response
+	if err := json.Unmarshal(bytes.TrimSpace(buf.Bytes()), &resps); err != nil {
+		t.Fatalf("decode batch response %q: %v", buf.String(), err)
+	}
+	if len(resps) != 1 {
+		t.Fatalf("got %d responses, want 1: %s", len(resps), buf.String())
+	}
+	if resps[0].Error == nil || resps[0].Error.Code != CodeRequestCancelled {
+		t.Fatalf("expected prompt cancellation, got %+v", resps[0])
+	}
+}
+
+func mustMarshal(t *testing.T, v any) json.RawMessage {
+	t.Helper()
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	return data
+}
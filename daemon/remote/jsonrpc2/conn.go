@@ -0,0 +1,472 @@
+package jsonrpc2
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Conn is a symmetric JSON-RPC 2.0 connection: either side may call
+// methods on the other via Call and Notify, and inbound requests are
+// dispatched to a Handler. It is inspired by the jsonrpc2.Conn type in
+// golang.org/x/tools/internal/jsonrpc2.
+type Conn struct {
+	handler Handler
+
+	// Logger, if non-nil, receives one structured log line per dispatched
+	// inbound request (method, id, duration_ms, error.code).
+	Logger *slog.Logger
+
+	stream Stream
+
+	seq atomic.Int64
+
+	mu      sync.Mutex
+	pending map[ID]chan *Response
+
+	handlingMu sync.Mutex
+	handling   map[ID]context.CancelFunc
+
+	done    chan struct{}
+	doneErr error
+	doneMu  sync.Mutex
+
+	// wg tracks every goroutine dispatching an inbound request, so Run can
+	// drain them before returning: otherwise a client that writes its
+	// requests and closes its side of the stream could have its process
+	// exit (main.go returns as soon as Run does) before the responses it's
+	// waiting on are ever written.
+	wg sync.WaitGroup
+}
+
+// NewConn constructs a Conn that reads and writes newline-delimited
+// JSON-RPC messages over r and w, dispatching inbound requests to
+// handler. It is a convenience wrapper around NewConnStream for the
+// default, backwards-compatible framing; call NewConnStream directly to
+// use HeaderStream or a transport-specific Stream instead. Call Run to
+// start reading.
+func NewConn(r io.Reader, w io.Writer, handler Handler) *Conn {
+	return NewConnStream(NewNewlineStream(r, w), handler)
+}
+
+// NewConnStream constructs a Conn over an arbitrary Stream, dispatching
+// inbound requests to handler. Call Run to start reading.
+func NewConnStream(stream Stream, handler Handler) *Conn {
+	if handler == nil {
+		handler = HandlerFunc(func(ctx context.Context, req *Request) (any, error) {
+			return nil, NewError(CodeMethodNotFound, fmt.Sprintf("unknown method %q", req.Method))
+		})
+	}
+	return &Conn{
+		handler:  handler,
+		stream:   stream,
+		pending:  make(map[ID]chan *Response),
+		handling: make(map[ID]context.CancelFunc),
+		done:     make(chan struct{}),
+	}
+}
+
+// Run reads frames from the connection's Stream until EOF or an error,
+// dispatching inbound requests to the handler and routing inbound
+// responses to their waiting Call. It blocks until the stream ends, and
+// the returned error (also io.EOF on a clean close) is delivered to every
+// pending Call.
+func (c *Conn) Run(ctx context.Context) error {
+	// Wait for every dispatched goroutine to finish and write its
+	// response before Run returns; see the wg field doc. The loop below
+	// calls closeWith as soon as the stream ends, before this wait, so
+	// Calls still pending on this side fail at once rather than waiting
+	// for responses that can no longer arrive; the deferred closeWith is
+	// then a no-op.
+	defer c.closeWith(io.ErrClosedPipe)
+	defer c.wg.Wait()
+
+	for {
+		frame, err := c.stream.Read(ctx)
+		if err != nil {
+			if err != io.EOF {
+				c.closeWith(err)
+				return err
+			}
+			c.closeWith(io.EOF)
+			return io.EOF
+		}
+		c.handleFrame(ctx, frame)
+	}
+}
+
+// handleFrame routes frame to the single-message or batch handler
+// depending on whether it's a JSON object or array. A batch is dispatched
+// on its own goroutine (tracked in c.wg, same as a single request) so a
+// slow batch item cannot stall the read loop.
+func (c *Conn) handleFrame(ctx context.Context, frame []byte) {
+	if trimmed := trimSpace(frame); len(trimmed) > 0 && trimmed[0] == '[' {
+		c.wg.Add(1)
+		go func() {
+			defer c.wg.Done()
+			c.handleBatchFrame(ctx, frame)
+		}()
+		return
+	}
+	c.handleSingleFrame(ctx, frame)
+}
+
+func (c *Conn) handleSingleFrame(ctx context.Context, frame []byte) {
+	// A frame is either a response (has "result" or "error" and an id we
+	// are waiting on) or a request/notification to dispatch.
+	var peek struct {
+		ID     *ID             `json:"id"`
+		Method string          `json:"method"`
+		Result json.RawMessage `json:"result"`
+		Error  *Error          `json:"error"`
+	}
+	if err := json.Unmarshal(frame, &peek); err != nil {
+		c.writeResponse(ctx, &Response{Error: NewError(CodeParseError, "parse error: "+err.Error())})
+		return
+	}
+
+	if peek.Method == "" && peek.ID != nil && (peek.Result != nil || peek.Error != nil) {
+		var resp Response
+		if err := json.Unmarshal(frame, &resp); err != nil {
+			return
+		}
+		c.deliver(&resp)
+		return
+	}
+
+	var req Request
+	if err := json.Unmarshal(frame, &req); err != nil {
+		c.writeResponse(ctx, &Response{Error: NewError(CodeInvalidRequest, "invalid request: "+err.Error())})
+		return
+	}
+	c.dispatch(ctx, &req)
+}
+
+// handleBatchFrame implements batch requests: a JSON array of requests
+// yields a single array-framed response, with one member per
+// non-notification item. Items run concurrently, but slots preserves
+// each item's position so the response array is ordered the same way the
+// request array was; a nil slot (a notification) is dropped when the
+// final array is built. The whole batch gets one jsonrpc.batch parent
+// span, with each item's instrumentAndHandle span nested under it as a
+// child, mirroring how golang.org/x/tools/internal/jsonrpc2 groups a
+// batch's sub-requests under their call.
+func (c *Conn) handleBatchFrame(ctx context.Context, frame []byte) {
+	var rawItems []json.RawMessage
+	if err := json.Unmarshal(frame, &rawItems); err != nil {
+		c.writeResponse(ctx, &Response{Error: NewError(CodeParseError, "parse error: "+err.Error())})
+		return
+	}
+	if len(rawItems) == 0 {
+		c.writeResponse(ctx, &Response{Error: NewError(CodeInvalidRequest, "empty batch")})
+		return
+	}
+
+	ctx, span := tracer.Start(ctx, "jsonrpc.batch", trace.WithAttributes(
+		attribute.Int("rpc.jsonrpc.batch_size", len(rawItems)),
+	))
+	defer span.End()
+
+	slots := make([]*Response, len(rawItems))
+
+	var itemWG sync.WaitGroup
+	for i, item := range rawItems {
+		var peek struct {
+			ID     *ID             `json:"id"`
+			Method string          `json:"method"`
+			Result json.RawMessage `json:"result"`
+			Error  *Error          `json:"error"`
+		}
+		if err := json.Unmarshal(item, &peek); err != nil {
+			slots[i] = NewErrorResponse(ID{}, NewError(CodeInvalidRequest, "invalid request: "+err.Error()))
+			continue
+		}
+		if peek.Method == "" && peek.ID != nil && (peek.Result != nil || peek.Error != nil) {
+			var resp Response
+			if err := json.Unmarshal(item, &resp); err == nil {
+				c.deliver(&resp)
+			}
+			continue
+		}
+		var req Request
+		if err := json.Unmarshal(item, &req); err != nil {
+			slots[i] = NewErrorResponse(ID{}, NewError(CodeInvalidRequest, "invalid request: "+err.Error()))
+			continue
+		}
+		if req.Method == "" {
+			if req.ID.IsValid() {
+				slots[i] = NewErrorResponse(req.ID, NewError(CodeInvalidRequest, "method is required"))
+			}
+			continue
+		}
+		if req.Method == CancelMethod {
+			slots[i] = c.cancel(&req)
+			continue
+		}
+
+		i, req := i, req
+		itemWG.Add(1)
+		go func() {
+			defer itemWG.Done()
+			slots[i] = c.dispatchTracked(ctx, &req)
+		}()
+	}
+	itemWG.Wait()
+
+	var responses []*Response
+	for _, resp := range slots {
+		if resp != nil {
+			responses = append(responses, resp)
+		}
+	}
+	if len(responses) == 0 {
+		return
+	}
+	c.writeBatchResponse(ctx, responses)
+}
+
+// dispatch runs req's handler in its own goroutine so that a slow or
+// blocked request cannot stall the read loop, cancellation of other
+// in-flight requests, or the client's own pending Calls. Every dispatched
+// goroutine is tracked in c.wg so Run can wait for it.
+func (c *Conn) dispatch(ctx context.Context, req *Request) {
+	if req.Method == CancelMethod {
+		if resp := c.cancel(req); resp != nil {
+			c.writeResponse(ctx, resp)
+		}
+		return
+	}
+
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		resp := c.dispatchTracked(ctx, req)
+		if resp != nil {
+			c.writeResponse(ctx, resp)
+		}
+	}()
+}
+
+// dispatchTracked runs req's handler via instrumentAndHandle, registering
+// a cancel func in c.handling first if req has a valid ID so a
+// $/cancelRequest naming it — whether it arrives as its own frame or as
+// another item in the same batch — can actually cancel it, instead of
+// only the single-frame path getting that guarantee. It is the one place
+// both dispatch (single frames) and handleBatchFrame (batch items) invoke
+// the handler, so the two paths can't drift out of sync again.
+func (c *Conn) dispatchTracked(ctx context.Context, req *Request) *Response {
+	if !req.ID.IsValid() {
+		return instrumentAndHandle(ctx, c.handler, req, c.Logger)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	c.handlingMu.Lock()
+	c.handling[req.ID] = cancel
+	c.handlingMu.Unlock()
+	defer func() {
+		c.handlingMu.Lock()
+		delete(c.handling, req.ID)
+		c.handlingMu.Unlock()
+		cancel()
+	}()
+
+	return instrumentAndHandle(ctx, c.handler, req, c.Logger)
+}
+
+// cancel implements the well-known $/cancelRequest method: it cancels the
+// context of the in-flight request named by params.ID (if any is still
+// running) and, if the handler implements Canceler, notifies it directly
+// so handlers managing resources outside of ctx (e.g. a blocked proxy
+// dial) can react too. It returns the response to send (nil if req was
+// itself a notification), shared by dispatch (single frames) and
+// handleBatchFrame (batch items).
+func (c *Conn) cancel(req *Request) *Response {
+	var params struct {
+		ID ID `json:"id"`
+	}
+	if len(req.Params) > 0 {
+		_ = json.Unmarshal(req.Params, &params)
+	}
+
+	c.handlingMu.Lock()
+	cancel, ok := c.handling[params.ID]
+	c.handlingMu.Unlock()
+	if ok {
+		cancel()
+	}
+
+	if canceler, ok := c.handler.(Canceler); ok {
+		canceler.Cancel(params.ID)
+	}
+
+	if !req.ID.IsValid() {
+		return nil
+	}
+	return mustResponse(req.ID, map[string]any{"cancelled": ok})
+}
+
+func mustResponse(id ID, result any) *Response {
+	resp, err := NewResponse(id, result)
+	if err != nil {
+		return NewErrorResponse(id, NewError(CodeInternalError, err.Error()))
+	}
+	return resp
+}
+
+func (c *Conn) deliver(resp *Response) {
+	c.mu.Lock()
+	ch, ok := c.pending[resp.ID]
+	if ok {
+		delete(c.pending, resp.ID)
+	}
+	c.mu.Unlock()
+	if ok {
+		ch <- resp
+	}
+}
+
+// Call invokes method on the remote peer with params, blocks until a
+// response arrives or ctx is done, and unmarshals the result into result
+// (which may be nil to discard it).
+func (c *Conn) Call(ctx context.Context, method string, params any, result any) error {
+	id := NewNumberID(c.seq.Add(1))
+	start := time.Now()
+	ctx, span := tracer.Start(ctx, method, trace.WithAttributes(
+		attribute.String("rpc.system", "jsonrpc"),
+		attribute.String("rpc.method", method),
+		attribute.String("rpc.id", id.String()),
+		attribute.String("direction", "client"),
+	))
+	defer span.End()
+
+	raw, err := marshalParams(params)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+	requestSizeHistogram.Record(ctx, int64(len(raw)))
+
+	ch := make(chan *Response, 1)
+	c.mu.Lock()
+	c.pending[id] = ch
+	c.mu.Unlock()
+
+	if err := c.writeRequest(ctx, &Request{ID: id, Method: method, Params: raw}); err != nil {
+		c.mu.Lock()
+		delete(c.pending, id)
+		c.mu.Unlock()
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+
+	var callErr error
+	select {
+	case resp := <-ch:
+		if resp.Error != nil {
+			callErr = resp.Error
+		} else {
+			responseSizeHistogram.Record(ctx, int64(len(resp.Result)))
+			if result != nil && len(resp.Result) > 0 {
+				callErr = json.Unmarshal(resp.Result, result)
+			}
+		}
+	case <-ctx.Done():
+		c.mu.Lock()
+		delete(c.pending, id)
+		c.mu.Unlock()
+		callErr = ctx.Err()
+	case <-c.done:
+		callErr = c.currentDoneErr()
+	}
+
+	durationHistogram.Record(ctx, float64(time.Since(start).Milliseconds()))
+	if callErr != nil {
+		span.SetStatus(codes.Error, callErr.Error())
+	}
+	return callErr
+}
+
+// Notify sends method with params to the remote peer without waiting for
+// a response.
+func (c *Conn) Notify(ctx context.Context, method string, params any) error {
+	raw, err := marshalParams(params)
+	if err != nil {
+		return err
+	}
+	return c.writeRequest(ctx, &Request{Method: method, Params: raw})
+}
+
+func marshalParams(params any) (json.RawMessage, error) {
+	if params == nil {
+		return nil, nil
+	}
+	return json.Marshal(params)
+}
+
+func (c *Conn) writeRequest(ctx context.Context, req *Request) error {
+	data, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	return c.stream.Write(ctx, data)
+}
+
+func (c *Conn) writeResponse(ctx context.Context, resp *Response) {
+	data, err := json.Marshal(resp)
+	if err != nil {
+		return
+	}
+	_ = c.stream.Write(ctx, data)
+}
+
+// writeBatchResponse writes responses as a single JSON array frame, the
+// batch counterpart to writeResponse.
+func (c *Conn) writeBatchResponse(ctx context.Context, responses []*Response) {
+	data, err := json.Marshal(responses)
+	if err != nil {
+		return
+	}
+	_ = c.stream.Write(ctx, data)
+}
+
+func (c *Conn) closeWith(err error) {
+	c.doneMu.Lock()
+	select {
+	case <-c.done:
+		c.doneMu.Unlock()
+		return
+	default:
+	}
+	c.doneErr = err
+	close(c.done)
+	c.doneMu.Unlock()
+
+	c.mu.Lock()
+	pending := c.pending
+	c.pending = make(map[ID]chan *Response)
+	c.mu.Unlock()
+	for _, ch := range pending {
+		ch <- &Response{Error: NewError(CodeInternalError, fmt.Sprintf("connection closed: %v", err))}
+	}
+}
+
+func (c *Conn) currentDoneErr() error {
+	c.doneMu.Lock()
+	defer c.doneMu.Unlock()
+	return c.doneErr
+}
+
+// Done returns a channel that is closed when the connection's Run loop
+// exits.
+func (c *Conn) Done() <-chan struct{} {
+	return c.done
+}
@@ -0,0 +1,180 @@
+package jsonrpc2
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+// pipeConns wires two Conns together over in-memory pipes so each can
+// call the other.
+func pipeConns(t *testing.T, serverHandler, clientHandler Handler) (server, client *Conn) {
+	t.Helper()
+	clientReader, serverWriter := io.Pipe()
+	serverReader, clientWriter := io.Pipe()
+
+	server = NewConn(serverReader, serverWriter, serverHandler)
+	client = NewConn(clientReader, clientWriter, clientHandler)
+
+	go server.Run(context.Background())
+	go client.Run(context.Background())
+	return server, client
+}
+
+func TestConnCallRoundTrip(t *testing.T) {
+	server, client := pipeConns(t, HandlerFunc(func(ctx context.Context, req *Request) (any, error) {
+		if req.Method != "ping" {
+			return nil, NewError(CodeMethodNotFound, "unknown method")
+		}
+		return map[string]any{"pong": true}, nil
+	}), HandlerFunc(func(ctx context.Context, req *Request) (any, error) {
+		return nil, NewError(CodeMethodNotFound, "client has no methods")
+	}))
+	defer server.closeWith(io.EOF)
+	defer client.closeWith(io.EOF)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	var result map[string]any
+	if err := client.Call(ctx, "ping", nil, &result); err != nil {
+		t.Fatalf("Call: %v", err)
+	}
+	if pong, _ := result["pong"].(bool); !pong {
+		t.Fatalf("unexpected result: %v", result)
+	}
+}
+
+func TestConnServerInitiatedCall(t *testing.T) {
+	// The "server" side calls a method on the "client" side, exercising
+	// the bidirectional flow that session.output / proxy.dialRequested
+	// style notifications depend on.
+	server, client := pipeConns(t, nil, HandlerFunc(func(ctx context.Context, req *Request) (any, error) {
+		if req.Method != "session.output" {
+			return nil, NewError(CodeMethodNotFound, "unknown method")
+		}
+		return map[string]any{"ack": true}, nil
+	}))
+	defer server.closeWith(io.EOF)
+	defer client.closeWith(io.EOF)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	var result map[string]any
+	if err := server.Call(ctx, "session.output", map[string]any{"chunk": "aGk="}, &result); err != nil {
+		t.Fatalf("Call: %v", err)
+	}
+	if ack, _ := result["ack"].(bool); !ack {
+		t.Fatalf("unexpected result: %v", result)
+	}
+}
+
+func TestConnBatchRequest(t *testing.T) {
+	// A JSON array frame is a batch: it must yield a single array-framed
+	// response containing one member per non-notification item, in
+	// request order.
+	var buf bytes.Buffer
+	stream := NewNewlineStream(strings.NewReader(
+		`[{"jsonrpc":"2.0","id":1,"method":"ping"},{"jsonrpc":"2.0","method":"ping"},{"jsonrpc":"2.0","id":2,"method":"missing"}]`+"\n",
+	), &buf)
+
+	conn := NewConnStream(stream, HandlerFunc(func(ctx context.Context, req *Request) (any, error) {
+		if req.Method != "ping" {
+			return nil, NewError(CodeMethodNotFound, "unknown method "+req.Method)
+		}
+		return map[string]any{"pong": true}, nil
+	}))
+	if err := conn.Run(context.Background()); err != io.EOF {
+		t.Fatalf("Run: %v", err)
+	}
+
+	var resps []Response
+	if err := json.Unmarshal(bytes.TrimSpace(buf.Bytes()), &resps); err != nil {
+		t.Fatalf("decode batch response %q: %v", buf.String(), err)
+	}
+	if len(resps) != 2 {
+		t.Fatalf("got %d responses, want 2 (notification skipped): %s", len(resps), buf.String())
+	}
+	if resps[1].Error == nil || resps[1].Error.Code != CodeMethodNotFound {
+		t.Fatalf("expected method_not_found for second response, got %+v", resps[1])
+	}
+}
+
+func TestConnRunDrainsInFlightDispatchBeforeReturning(t *testing.T) {
+	// Regression test: Run used to return the instant the stream hit EOF,
+	// without waiting for the goroutine dispatch spawned for each request
+	// to finish writing its response. A client (or the stdio CLI's own
+	// test pattern) that writes requests and then closes its side of the
+	// stream could see Run return with some responses never written.
+	started := make(chan struct{})
+	release := make(chan struct{})
+	var buf bytes.Buffer
+	stream := NewNewlineStream(strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"slow"}`+"\n"), &buf)
+
+	conn := NewConnStream(stream, HandlerFunc(func(ctx context.Context, req *Request) (any, error) {
+		close(started)
+		<-release
+		return map[string]any{"ok": true}, nil
+	}))
+
+	done := make(chan error, 1)
+	go func() { done <- conn.Run(context.Background()) }()
+
+	select {
+	case <-started:
+	case <-time.After(2 * time.Second):
+		t.Fatal("handler never started")
+	}
+	// The stream is already at EOF, so Run's read loop is only waiting on
+	// the in-flight dispatch goroutine at this point; release it and make
+	// sure Run doesn't return until it's done writing the response.
+	close(release)
+
+	select {
+	case err := <-done:
+		if err != io.EOF {
+			t.Fatalf("Run: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Run never returned")
+	}
+
+	var resp Response
+	if err := json.Unmarshal(bytes.TrimSpace(buf.Bytes()), &resp); err != nil {
+		t.Fatalf("Run returned without writing the in-flight response: decode %q: %v", buf.String(), err)
+	}
+	if resp.Error != nil {
+		t.Fatalf("unexpected error: %v", resp.Error)
+	}
+}
+
+func TestConnNotifyDoesNotBlock(t *testing.T) {
+	received := make(chan string, 1)
+	server, client := pipeConns(t, HandlerFunc(func(ctx context.Context, req *Request) (any, error) {
+		received <- req.Method
+		return nil, nil
+	}), nil)
+	defer server.closeWith(io.EOF)
+	defer client.closeWith(io.EOF)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	if err := client.Notify(ctx, "session.exit", map[string]any{"code": 0}); err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+
+	select {
+	case method := <-received:
+		if method != "session.exit" {
+			t.Fatalf("got method %q, want session.exit", method)
+		}
+	case <-ctx.Done():
+		t.Fatal("timed out waiting for notification")
+	}
+}
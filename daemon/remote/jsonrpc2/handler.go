@@ -0,0 +1,30 @@
+package jsonrpc2
+
+import "context"
+
+// Handler dispatches a single JSON-RPC request and returns a result to be
+// marshaled into the response, or an error. Returning a *Error preserves
+// its code and data; any other error is reported as CodeInternalError.
+type Handler interface {
+	Handle(ctx context.Context, req *Request) (any, error)
+}
+
+// HandlerFunc adapts a function to a Handler.
+type HandlerFunc func(ctx context.Context, req *Request) (any, error)
+
+// Handle calls f(ctx, req).
+func (f HandlerFunc) Handle(ctx context.Context, req *Request) (any, error) {
+	return f(ctx, req)
+}
+
+// toError normalizes any error returned by a Handler into a JSON-RPC
+// *Error, defaulting to CodeInternalError.
+func toError(err error) *Error {
+	if err == nil {
+		return nil
+	}
+	if rerr, ok := err.(*Error); ok {
+		return rerr
+	}
+	return NewError(CodeInternalError, err.Error())
+}
@@ -0,0 +1,193 @@
+// Package jsonrpc2 implements the JSON-RPC 2.0 wire protocol
+// (https://www.jsonrpc.org/specification) over a Stream, either
+// line-delimited (NewlineStream) or Content-Length framed (HeaderStream).
+package jsonrpc2
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// Version is the "jsonrpc" version marker required on every request and
+// response.
+const Version = "2.0"
+
+// Standard error codes defined by the JSON-RPC 2.0 specification.
+const (
+	CodeParseError     = -32700
+	CodeInvalidRequest = -32600
+	CodeMethodNotFound = -32601
+	CodeInvalidParams  = -32602
+	CodeInternalError  = -32603
+)
+
+// ID is a JSON-RPC request id. It holds either a string, a number, or
+// nothing at all (the zero value), which represents a notification or a
+// null response id. ID is comparable and safe to use as a map key.
+type ID struct {
+	value any // nil, string, or json.Number
+	set   bool
+}
+
+// NewNumberID returns a numeric ID.
+func NewNumberID(n int64) ID {
+	return ID{value: json.Number(fmt.Sprintf("%d", n)), set: true}
+}
+
+// NewStringID returns a string ID.
+func NewStringID(s string) ID {
+	return ID{value: s, set: true}
+}
+
+// IsValid reports whether the ID was present on the wire, i.e. whether
+// this is a request (as opposed to a notification).
+func (id ID) IsValid() bool {
+	return id.set
+}
+
+// String returns a human-readable form of the ID, for logging.
+func (id ID) String() string {
+	if !id.set {
+		return "<none>"
+	}
+	return fmt.Sprintf("%v", id.value)
+}
+
+// MarshalJSON implements json.Marshaler.
+func (id ID) MarshalJSON() ([]byte, error) {
+	if !id.set {
+		return []byte("null"), nil
+	}
+	return json.Marshal(id.value)
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (id *ID) UnmarshalJSON(data []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return err
+	}
+	switch v.(type) {
+	case nil:
+		*id = ID{}
+	case string, json.Number:
+		*id = ID{value: v, set: true}
+	default:
+		return fmt.Errorf("jsonrpc2: id must be a string, number, or null, got %T", v)
+	}
+	return nil
+}
+
+// Error is a JSON-RPC error object.
+type Error struct {
+	Code    int64           `json:"code"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data,omitempty"`
+}
+
+// NewError returns an *Error with the given code and message.
+func NewError(code int64, message string) *Error {
+	return &Error{Code: code, Message: message}
+}
+
+// Error implements the error interface.
+func (e *Error) Error() string {
+	return fmt.Sprintf("jsonrpc2: code %d: %s", e.Code, e.Message)
+}
+
+// Request is a decoded JSON-RPC request or notification. A Request with
+// an invalid ID (ID.IsValid() == false) is a notification and must not
+// receive a response.
+type Request struct {
+	ID     ID
+	Method string
+	Params json.RawMessage
+}
+
+// wireRequest is the on-the-wire shape of a Request.
+type wireRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      *ID             `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+// Response is a decoded JSON-RPC response.
+type Response struct {
+	ID     ID
+	Result json.RawMessage
+	Error  *Error
+}
+
+// wireResponse is the on-the-wire shape of a Response.
+type wireResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      ID              `json:"id"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *Error          `json:"error,omitempty"`
+}
+
+// NewResponse builds a successful Response, marshaling result to JSON.
+func NewResponse(id ID, result any) (*Response, error) {
+	raw, err := json.Marshal(result)
+	if err != nil {
+		return nil, err
+	}
+	return &Response{ID: id, Result: raw}, nil
+}
+
+// NewErrorResponse builds a Response carrying an error.
+func NewErrorResponse(id ID, err *Error) *Response {
+	return &Response{ID: id, Error: err}
+}
+
+func (r *Request) UnmarshalJSON(data []byte) error {
+	var wire wireRequest
+	if err := json.Unmarshal(data, &wire); err != nil {
+		return err
+	}
+	r.Method = wire.Method
+	r.Params = wire.Params
+	if wire.ID != nil {
+		r.ID = *wire.ID
+	} else {
+		r.ID = ID{}
+	}
+	return nil
+}
+
+func (r Request) MarshalJSON() ([]byte, error) {
+	wire := wireRequest{
+		JSONRPC: Version,
+		Method:  r.Method,
+		Params:  r.Params,
+	}
+	if r.ID.IsValid() {
+		wire.ID = &r.ID
+	}
+	return json.Marshal(wire)
+}
+
+func (r *Response) UnmarshalJSON(data []byte) error {
+	var wire wireResponse
+	if err := json.Unmarshal(data, &wire); err != nil {
+		return err
+	}
+	r.ID = wire.ID
+	r.Result = wire.Result
+	r.Error = wire.Error
+	return nil
+}
+
+func (r Response) MarshalJSON() ([]byte, error) {
+	wire := wireResponse{
+		JSONRPC: Version,
+		ID:      r.ID,
+		Result:  r.Result,
+		Error:   r.Error,
+	}
+	return json.Marshal(wire)
+}
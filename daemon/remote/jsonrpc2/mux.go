@@ -0,0 +1,48 @@
+package jsonrpc2
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// Mux dispatches requests to handlers registered by method name. The zero
+// value is not usable; construct one with NewMux. Mux itself implements
+// Handler, so it can be passed directly to NewConn or NewConnStream.
+type Mux struct {
+	mu       sync.RWMutex
+	handlers map[string]Handler
+}
+
+// NewMux returns an empty Mux.
+func NewMux() *Mux {
+	return &Mux{handlers: make(map[string]Handler)}
+}
+
+// Register binds h to serve method. It panics if method is already
+// registered, mirroring net/http.ServeMux.
+func (m *Mux) Register(method string, h Handler) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.handlers[method]; ok {
+		panic(fmt.Sprintf("jsonrpc2: method %q already registered", method))
+	}
+	m.handlers[method] = h
+}
+
+// RegisterFunc binds f to serve method.
+func (m *Mux) RegisterFunc(method string, f func(ctx context.Context, req *Request) (any, error)) {
+	m.Register(method, HandlerFunc(f))
+}
+
+// Handle implements Handler by looking up the request method and
+// delegating to the registered handler, or returning CodeMethodNotFound.
+func (m *Mux) Handle(ctx context.Context, req *Request) (any, error) {
+	m.mu.RLock()
+	h, ok := m.handlers[req.Method]
+	m.mu.RUnlock()
+	if !ok {
+		return nil, NewError(CodeMethodNotFound, fmt.Sprintf("unknown method %q", req.Method))
+	}
+	return h.Handle(ctx, req)
+}
@@ -0,0 +1,175 @@
+package jsonrpc2
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Stream is a framing strategy for reading and writing JSON-RPC messages
+// over an underlying byte stream. Read blocks until a complete message is
+// available and returns its raw bytes (a single object or batch array,
+// with any frame delimiters already stripped); Write frames and sends
+// one message. Implementations must make Write safe for concurrent use,
+// since Conn writes requests, responses, and notifications from
+// different goroutines.
+//
+// Conn depends only on this interface, so a future transport (TCP, a
+// Unix socket) can plug in a new Stream without touching the dispatcher.
+type Stream interface {
+	Read(ctx context.Context) ([]byte, error)
+	Write(ctx context.Context, data []byte) error
+}
+
+// NewlineStream is the historic framing: one JSON value per line. It is
+// the default for --stdio, kept for backwards compatibility with
+// existing clients.
+type NewlineStream struct {
+	scanner *bufio.Scanner
+
+	writeMu sync.Mutex
+	writer  *bufio.Writer
+}
+
+// NewNewlineStream returns a Stream that reads newline-delimited JSON
+// values from r and writes them, each followed by '\n', to w.
+func NewNewlineStream(r io.Reader, w io.Writer) *NewlineStream {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	return &NewlineStream{scanner: scanner, writer: bufio.NewWriter(w)}
+}
+
+// Read returns the next non-blank line, or io.EOF once the underlying
+// reader is exhausted.
+func (s *NewlineStream) Read(ctx context.Context) ([]byte, error) {
+	for s.scanner.Scan() {
+		line := s.scanner.Bytes()
+		if len(trimSpace(line)) == 0 {
+			continue
+		}
+		// Copy because Scanner reuses its buffer.
+		return append([]byte(nil), line...), nil
+	}
+	if err := s.scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, io.EOF
+}
+
+// Write sends data followed by a newline.
+func (s *NewlineStream) Write(ctx context.Context, data []byte) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	if _, err := s.writer.Write(data); err != nil {
+		return err
+	}
+	if err := s.writer.WriteByte('\n'); err != nil {
+		return err
+	}
+	return s.writer.Flush()
+}
+
+// defaultMaxHeaderBodySize bounds how large a HeaderStream will let a
+// single Content-Length claim to be, so a peer can't wedge the daemon
+// into allocating an unbounded buffer.
+const defaultMaxHeaderBodySize = 32 * 1024 * 1024
+
+// HeaderStream implements LSP-style framing: each message is preceded by
+// a block of "Name: Value\r\n" headers terminated by a blank line, with
+// a required Content-Length giving the payload's exact byte length. This
+// is the same framing used by jsonrpc2/LSP servers, and lets a message
+// contain raw newlines or binary blobs that line-delimited JSON cannot.
+type HeaderStream struct {
+	reader *bufio.Reader
+
+	writeMu sync.Mutex
+	writer  io.Writer
+
+	// MaxBodySize rejects any Content-Length larger than this many bytes.
+	// Zero means defaultMaxHeaderBodySize.
+	MaxBodySize int64
+}
+
+// NewHeaderStream returns a Stream that reads and writes
+// Content-Length-framed messages, as described on HeaderStream.
+func NewHeaderStream(r io.Reader, w io.Writer) *HeaderStream {
+	return &HeaderStream{reader: bufio.NewReader(r), writer: w}
+}
+
+// Read parses one header block and returns its payload.
+func (s *HeaderStream) Read(ctx context.Context) ([]byte, error) {
+	contentLength := int64(-1)
+	for {
+		line, err := s.reader.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			break
+		}
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue // lenient: ignore malformed header lines, as LSP servers do
+		}
+		if !strings.EqualFold(strings.TrimSpace(name), "Content-Length") {
+			continue
+		}
+		n, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("jsonrpc2: invalid Content-Length %q: %w", value, err)
+		}
+		contentLength = n
+	}
+
+	if contentLength < 0 {
+		return nil, fmt.Errorf("jsonrpc2: missing Content-Length header")
+	}
+	maxBody := s.MaxBodySize
+	if maxBody <= 0 {
+		maxBody = defaultMaxHeaderBodySize
+	}
+	if contentLength > maxBody {
+		return nil, fmt.Errorf("jsonrpc2: Content-Length %d exceeds max body size %d", contentLength, maxBody)
+	}
+
+	body := make([]byte, contentLength)
+	if _, err := io.ReadFull(s.reader, body); err != nil {
+		return nil, err
+	}
+	return body, nil
+}
+
+// Write frames data behind a Content-Length (and Content-Type, per LSP
+// convention) header and writes both while holding writeMu so headers
+// and body from concurrent writers cannot interleave.
+func (s *HeaderStream) Write(ctx context.Context, data []byte) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	header := fmt.Sprintf("Content-Length: %d\r\nContent-Type: application/vscode-jsonrpc; charset=utf-8\r\n\r\n", len(data))
+	if _, err := io.WriteString(s.writer, header); err != nil {
+		return err
+	}
+	_, err := s.writer.Write(data)
+	return err
+}
+
+func trimSpace(b []byte) []byte {
+	start := 0
+	for start < len(b) && isWhitespace(b[start]) {
+		start++
+	}
+	end := len(b)
+	for end > start && isWhitespace(b[end-1]) {
+		end--
+	}
+	return b[start:end]
+}
+
+func isWhitespace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r' || c == '\n'
+}
@@ -0,0 +1,147 @@
+package jsonrpc2
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestNewlineStreamRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	s := NewNewlineStream(strings.NewReader("\n  \n{\"jsonrpc\":\"2.0\",\"id\":1,\"method\":\"ping\"}\n"), &buf)
+
+	got, err := s.Read(context.Background())
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	want := `{"jsonrpc":"2.0","id":1,"method":"ping"}`
+	if string(got) != want {
+		t.Fatalf("Read = %q, want %q (blank lines should be skipped)", got, want)
+	}
+
+	if _, err := s.Read(context.Background()); err != io.EOF {
+		t.Fatalf("Read at EOF = %v, want io.EOF", err)
+	}
+
+	if err := s.Write(context.Background(), []byte(want)); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if buf.String() != want+"\n" {
+		t.Fatalf("Write wrote %q, want %q", buf.String(), want+"\n")
+	}
+}
+
+func TestHeaderStreamRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	s := NewHeaderStream(&buf, &buf)
+	ctx := context.Background()
+
+	want := []byte(`{"jsonrpc":"2.0","id":1,"method":"ping"}`)
+	if err := s.Write(ctx, want); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+
+	got, err := s.Read(ctx)
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("Read = %q, want %q", got, want)
+	}
+}
+
+func TestHeaderStreamReadAcrossPartialReads(t *testing.T) {
+	payload := `{"jsonrpc":"2.0","id":1,"method":"ping"}`
+	frame := fmt.Sprintf("Content-Length: %d\r\nContent-Type: application/vscode-jsonrpc; charset=utf-8\r\n\r\n%s", len(payload), payload)
+
+	s := NewHeaderStream(&dribbleReader{data: []byte(frame), chunk: 3}, io.Discard)
+	got, err := s.Read(context.Background())
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	if string(got) != payload {
+		t.Fatalf("Read = %q, want %q", got, payload)
+	}
+}
+
+func TestHeaderStreamMissingContentLength(t *testing.T) {
+	s := NewHeaderStream(strings.NewReader("Content-Type: application/vscode-jsonrpc\r\n\r\n{}"), io.Discard)
+	if _, err := s.Read(context.Background()); err == nil {
+		t.Fatal("expected error for missing Content-Length")
+	}
+}
+
+func TestHeaderStreamNonNumericContentLength(t *testing.T) {
+	s := NewHeaderStream(strings.NewReader("Content-Length: not-a-number\r\n\r\n{}"), io.Discard)
+	if _, err := s.Read(context.Background()); err == nil {
+		t.Fatal("expected error for non-numeric Content-Length")
+	}
+}
+
+func TestHeaderStreamOversizedBodyRejected(t *testing.T) {
+	s := NewHeaderStream(strings.NewReader("Content-Length: 1000\r\n\r\n"), io.Discard)
+	s.MaxBodySize = 16
+	if _, err := s.Read(context.Background()); err == nil {
+		t.Fatal("expected error for Content-Length exceeding MaxBodySize")
+	}
+}
+
+func TestHeaderStreamTruncatedBodyIsUnexpectedEOF(t *testing.T) {
+	s := NewHeaderStream(strings.NewReader("Content-Length: 10\r\n\r\nabc"), io.Discard)
+	if _, err := s.Read(context.Background()); err != io.ErrUnexpectedEOF {
+		t.Fatalf("Read = %v, want io.ErrUnexpectedEOF for a body shorter than Content-Length", err)
+	}
+}
+
+// dribbleReader returns at most chunk bytes per Read call, exercising the
+// header parser's handling of reads that split a frame across buffer
+// boundaries.
+type dribbleReader struct {
+	data  []byte
+	chunk int
+}
+
+func (r *dribbleReader) Read(p []byte) (int, error) {
+	if len(r.data) == 0 {
+		return 0, io.EOF
+	}
+	n := r.chunk
+	if n > len(p) {
+		n = len(p)
+	}
+	if n > len(r.data) {
+		n = len(r.data)
+	}
+	copy(p, r.data[:n])
+	r.data = r.data[n:]
+	return n, nil
+}
+
+// FuzzHeaderStreamRead feeds arbitrary byte sequences to the header
+// parser and only requires that it never panics and never returns more
+// bytes than a valid Content-Length would allow.
+func FuzzHeaderStreamRead(f *testing.F) {
+	f.Add([]byte("Content-Length: 2\r\n\r\n{}"))
+	f.Add([]byte("Content-Length: 0\r\n\r\n"))
+	f.Add([]byte("content-length: 5\r\nContent-Type: x\r\n\r\nhello"))
+	f.Add([]byte("Content-Length: notanumber\r\n\r\n"))
+	f.Add([]byte("\r\n\r\n"))
+	f.Add([]byte("Content-Length: 999999999999\r\n\r\n"))
+	f.Add([]byte(""))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		s := NewHeaderStream(bytes.NewReader(data), io.Discard)
+		s.MaxBodySize = 4096
+
+		body, err := s.Read(context.Background())
+		if err != nil {
+			return
+		}
+		if int64(len(body)) > s.MaxBodySize {
+			t.Fatalf("Read returned %d bytes, exceeding MaxBodySize %d", len(body), s.MaxBodySize)
+		}
+	})
+}
@@ -0,0 +1,109 @@
+package jsonrpc2
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentationName identifies this package to the OpenTelemetry SDK.
+// Following the pattern used by golang.org/x/tools/internal/jsonrpc2, the
+// tracer and meter are package-level: they no-op until the process wires
+// up a real TracerProvider/MeterProvider (e.g. via --otlp-endpoint), so
+// every Conn gets tracing for free with no extra plumbing.
+const instrumentationName = "github.com/manaflow-ai/cmux/daemon/remote/jsonrpc2"
+
+var tracer = otel.Tracer(instrumentationName)
+
+var meter = otel.Meter(instrumentationName)
+
+var (
+	durationHistogram, _ = meter.Float64Histogram(
+		"rpc.server.duration",
+		metric.WithDescription("Duration of a dispatched JSON-RPC request"),
+		metric.WithUnit("ms"),
+	)
+	requestSizeHistogram, _ = meter.Int64Histogram(
+		"rpc.server.request.size",
+		metric.WithDescription("Size of a JSON-RPC request's params"),
+		metric.WithUnit("By"),
+	)
+	responseSizeHistogram, _ = meter.Int64Histogram(
+		"rpc.server.response.size",
+		metric.WithDescription("Size of a JSON-RPC response's result"),
+		metric.WithUnit("By"),
+	)
+)
+
+// instrumentAndHandle runs handler.Handle(ctx, req) wrapped in a span
+// named after the method (tagged rpc.system=jsonrpc, rpc.method, rpc.id,
+// direction=server), records the rpc.server.* histograms, and — if
+// logger is non-nil — emits one structured log line for the call. It
+// returns the Response to send, or nil for a notification.
+func instrumentAndHandle(ctx context.Context, handler Handler, req *Request, logger *slog.Logger) *Response {
+	start := time.Now()
+	ctx, span := tracer.Start(ctx, req.Method, trace.WithAttributes(
+		attribute.String("rpc.system", "jsonrpc"),
+		attribute.String("rpc.method", req.Method),
+		attribute.String("rpc.id", req.ID.String()),
+		attribute.String("direction", "server"),
+	))
+	defer span.End()
+
+	requestSizeHistogram.Record(ctx, int64(len(req.Params)))
+
+	result, err := handler.Handle(ctx, req)
+
+	var rerr *Error
+	if err != nil {
+		if ctx.Err() == context.Canceled {
+			err = NewError(CodeRequestCancelled, "request cancelled")
+			span.AddEvent("request.cancelled")
+		}
+		rerr = toError(err)
+		span.SetStatus(codes.Error, rerr.Message)
+	}
+
+	var resp *Response
+	if req.ID.IsValid() {
+		if rerr != nil {
+			resp = NewErrorResponse(req.ID, rerr)
+		} else {
+			var merr error
+			resp, merr = NewResponse(req.ID, result)
+			if merr != nil {
+				rerr = NewError(CodeInternalError, merr.Error())
+				resp = NewErrorResponse(req.ID, rerr)
+				span.SetStatus(codes.Error, rerr.Message)
+			}
+		}
+		responseSizeHistogram.Record(ctx, int64(len(resp.Result)))
+	}
+
+	durationHistogram.Record(ctx, float64(time.Since(start).Milliseconds()))
+	logRequest(logger, req, start, rerr)
+	return resp
+}
+
+func logRequest(logger *slog.Logger, req *Request, start time.Time, rerr *Error) {
+	if logger == nil {
+		return
+	}
+	attrs := []any{
+		slog.String("method", req.Method),
+		slog.String("id", req.ID.String()),
+		slog.Int64("duration_ms", time.Since(start).Milliseconds()),
+	}
+	if rerr != nil {
+		attrs = append(attrs, slog.Int64("error.code", rerr.Code))
+		logger.Error("jsonrpc2 request", attrs...)
+		return
+	}
+	logger.Info("jsonrpc2 request", attrs...)
+}
@@ -0,0 +1,22 @@
+package proxy
+
+import (
+	"bufio"
+	"net"
+	"time"
+)
+
+// noDeadline clears a previously set net.Conn deadline.
+var noDeadline time.Time
+
+// bufferedConn wraps a net.Conn whose initial bytes have already been
+// buffered by r, replaying them before falling through to further reads
+// off the underlying connection.
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (b *bufferedConn) Read(p []byte) (int, error) {
+	return b.r.Read(p)
+}
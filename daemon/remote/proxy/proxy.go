@@ -0,0 +1,277 @@
+// Package proxy backs the proxy.http_connect and proxy.socks5 capabilities
+// advertised by cmuxd-remote's hello response: it opens outbound streams
+// through an upstream HTTP CONNECT or SOCKS5 proxy and shuttles bytes to
+// and from the jsonrpc2 client that requested them.
+package proxy
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/manaflow-ai/cmux/daemon/remote/jsonrpc2"
+)
+
+// defaultWindowSize is the number of unread bytes the manager will buffer
+// per stream before it stops reading from the upstream connection and
+// waits for the buffer to drain, via pushLoop's proxy.data notifications
+// or the client's proxy.read calls.
+const defaultWindowSize = 64 * 1024
+
+// defaultDialTimeout bounds how long opening a stream may take.
+const defaultDialTimeout = 10 * time.Second
+
+// Config configures the proxy subsystem.
+type Config struct {
+	// HTTPConnectUpstream is the "host:port" of the upstream HTTP proxy
+	// used to satisfy protocol "http_connect".
+	HTTPConnectUpstream string
+	// SOCKS5Upstream is the "host:port" of the upstream SOCKS5 proxy used
+	// to satisfy protocol "socks5".
+	SOCKS5Upstream string
+	// WindowSize caps the bytes buffered per stream before backpressure
+	// kicks in. Defaults to 64KiB.
+	WindowSize int
+	// DialTimeout bounds proxy.open. Defaults to 10s.
+	DialTimeout time.Duration
+}
+
+// Notifier is the subset of *jsonrpc2.Conn the manager needs in order to
+// push server-initiated notifications (proxy.data, proxy.window_update).
+type Notifier interface {
+	Notify(ctx context.Context, method string, params any) error
+}
+
+// Manager implements the proxy.* RPC methods and owns all open streams.
+type Manager struct {
+	cfg    Config
+	notify Notifier
+
+	nextID atomic.Int64
+
+	mu      sync.Mutex
+	streams map[string]*stream
+}
+
+// NewManager constructs a Manager that pushes notifications via notify.
+func NewManager(cfg Config, notify Notifier) *Manager {
+	if cfg.WindowSize <= 0 {
+		cfg.WindowSize = defaultWindowSize
+	}
+	if cfg.DialTimeout <= 0 {
+		cfg.DialTimeout = defaultDialTimeout
+	}
+	return &Manager{cfg: cfg, notify: notify, streams: make(map[string]*stream)}
+}
+
+// Register binds the proxy.* methods onto mux.
+func (m *Manager) Register(mux *jsonrpc2.Mux) {
+	mux.RegisterFunc("proxy.open", m.handleOpen)
+	mux.RegisterFunc("proxy.write", m.handleWrite)
+	mux.RegisterFunc("proxy.read", m.handleRead)
+	mux.RegisterFunc("proxy.close", m.handleClose)
+}
+
+type openParams struct {
+	Protocol string      `json:"protocol"`
+	Target   string      `json:"target"`
+	Auth     *authParams `json:"auth,omitempty"`
+}
+
+type authParams struct {
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+}
+
+func (m *Manager) handleOpen(ctx context.Context, req *jsonrpc2.Request) (any, error) {
+	var params openParams
+	if err := unmarshalParams(req, &params); err != nil {
+		return nil, err
+	}
+	if params.Target == "" {
+		return nil, jsonrpc2.NewError(jsonrpc2.CodeInvalidParams, "target is required")
+	}
+
+	dialCtx, cancel := context.WithTimeout(ctx, m.cfg.DialTimeout)
+	defer cancel()
+
+	var (
+		conn net.Conn
+		err  error
+	)
+	switch params.Protocol {
+	case "http_connect":
+		if m.cfg.HTTPConnectUpstream == "" {
+			return nil, jsonrpc2.NewError(jsonrpc2.CodeInvalidParams, "http_connect upstream is not configured")
+		}
+		conn, err = dialHTTPConnect(dialCtx, m.cfg.HTTPConnectUpstream, params.Target, params.Auth)
+	case "socks5":
+		if m.cfg.SOCKS5Upstream == "" {
+			return nil, jsonrpc2.NewError(jsonrpc2.CodeInvalidParams, "socks5 upstream is not configured")
+		}
+		conn, err = dialSOCKS5(dialCtx, m.cfg.SOCKS5Upstream, params.Target, params.Auth)
+	default:
+		return nil, jsonrpc2.NewError(jsonrpc2.CodeInvalidParams, fmt.Sprintf("unsupported protocol %q", params.Protocol))
+	}
+	if err != nil {
+		return nil, jsonrpc2.NewError(jsonrpc2.CodeInternalError, fmt.Sprintf("dial %s via %s: %v", params.Target, params.Protocol, err))
+	}
+
+	id := fmt.Sprintf("proxy-%d", m.nextID.Add(1))
+	s := newStream(id, conn, m.cfg.WindowSize)
+	m.mu.Lock()
+	m.streams[id] = s
+	m.mu.Unlock()
+
+	go m.pump(s)
+	go m.pushLoop(s)
+
+	return map[string]any{"stream_id": id}, nil
+}
+
+type streamParams struct {
+	StreamID string `json:"stream_id"`
+}
+
+type writeParams struct {
+	StreamID string `json:"stream_id"`
+	Data     string `json:"data"`
+}
+
+func (m *Manager) handleWrite(ctx context.Context, req *jsonrpc2.Request) (any, error) {
+	var params writeParams
+	if err := unmarshalParams(req, &params); err != nil {
+		return nil, err
+	}
+	s, err := m.lookup(params.StreamID)
+	if err != nil {
+		return nil, err
+	}
+	data, err := base64.StdEncoding.DecodeString(params.Data)
+	if err != nil {
+		return nil, jsonrpc2.NewError(jsonrpc2.CodeInvalidParams, "data must be base64: "+err.Error())
+	}
+	n, err := s.conn.Write(data)
+	if err != nil {
+		return nil, jsonrpc2.NewError(jsonrpc2.CodeInternalError, "write: "+err.Error())
+	}
+	return map[string]any{"written": n}, nil
+}
+
+// handleRead drains one buffered chunk for streams whose client prefers
+// pulling over listening for proxy.data notifications. It never blocks:
+// if nothing is buffered it returns an empty, non-eof chunk.
+func (m *Manager) handleRead(ctx context.Context, req *jsonrpc2.Request) (any, error) {
+	var params streamParams
+	if err := unmarshalParams(req, &params); err != nil {
+		return nil, err
+	}
+	s, err := m.lookup(params.StreamID)
+	if err != nil {
+		return nil, err
+	}
+
+	select {
+	case chunk, ok := <-s.out:
+		if !ok {
+			return map[string]any{"data": "", "eof": true}, nil
+		}
+		s.bufferedBytes.Add(-int64(len(chunk)))
+		return map[string]any{"data": base64.StdEncoding.EncodeToString(chunk), "eof": false}, nil
+	default:
+		return map[string]any{"data": "", "eof": false}, nil
+	}
+}
+
+func (m *Manager) handleClose(ctx context.Context, req *jsonrpc2.Request) (any, error) {
+	var params streamParams
+	if err := unmarshalParams(req, &params); err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	s, ok := m.streams[params.StreamID]
+	delete(m.streams, params.StreamID)
+	m.mu.Unlock()
+	if !ok {
+		return nil, jsonrpc2.NewError(jsonrpc2.CodeInvalidParams, fmt.Sprintf("unknown stream_id %q", params.StreamID))
+	}
+	s.conn.Close()
+	return map[string]any{"closed": true}, nil
+}
+
+func (m *Manager) lookup(id string) (*stream, error) {
+	m.mu.Lock()
+	s, ok := m.streams[id]
+	m.mu.Unlock()
+	if !ok {
+		return nil, jsonrpc2.NewError(jsonrpc2.CodeInvalidParams, fmt.Sprintf("unknown stream_id %q", id))
+	}
+	return s, nil
+}
+
+// pump reads from s.conn and buffers each chunk into s.out. s.out is
+// bounded to the configured window size, so once it fills, the blocking
+// send below stalls this goroutine (and therefore further conn.Read
+// calls) until a consumer drains it — that block is the flow control.
+func (m *Manager) pump(s *stream) {
+	defer m.closeStream(s)
+
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := s.conn.Read(buf)
+		if n > 0 {
+			chunk := append([]byte(nil), buf[:n]...)
+			s.bufferedBytes.Add(int64(n))
+			s.out <- chunk
+		}
+		if err != nil {
+			close(s.out)
+			return
+		}
+	}
+}
+
+// pushLoop drains s.out and forwards each chunk to the client as a
+// proxy.data notification, following up with proxy.window_update to
+// report the capacity that draining just freed. It is the default
+// consumer of s.out; a client may instead (or additionally) call
+// proxy.read, which races pushLoop for the next queued chunk.
+func (m *Manager) pushLoop(s *stream) {
+	for chunk := range s.out {
+		_ = m.notify.Notify(context.Background(), "proxy.data", map[string]any{
+			"stream_id": s.id,
+			"data":      base64.StdEncoding.EncodeToString(chunk),
+		})
+		buffered := s.bufferedBytes.Add(-int64(len(chunk)))
+		_ = m.notify.Notify(context.Background(), "proxy.window_update", map[string]any{
+			"stream_id": s.id,
+			"available": s.windowSize - int(buffered),
+		})
+	}
+	_ = m.notify.Notify(context.Background(), "proxy.data", map[string]any{
+		"stream_id": s.id,
+		"eof":       true,
+	})
+}
+
+func (m *Manager) closeStream(s *stream) {
+	m.mu.Lock()
+	delete(m.streams, s.id)
+	m.mu.Unlock()
+	s.conn.Close()
+}
+
+func unmarshalParams(req *jsonrpc2.Request, dst any) error {
+	if len(req.Params) == 0 {
+		return jsonrpc2.NewError(jsonrpc2.CodeInvalidParams, "params are required")
+	}
+	if err := json.Unmarshal(req.Params, dst); err != nil {
+		return jsonrpc2.NewError(jsonrpc2.CodeInvalidParams, "invalid params: "+err.Error())
+	}
+	return nil
+}
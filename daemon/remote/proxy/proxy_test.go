@@ -0,0 +1,341 @@
+package proxy
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/textproto"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/manaflow-ai/cmux/daemon/remote/jsonrpc2"
+)
+
+// recordingNotifier captures every Notify call so tests can assert on the
+// proxy.data/proxy.window_update stream the manager pushes.
+type recordingNotifier struct {
+	mu    sync.Mutex
+	calls []notifyCall
+	data  chan map[string]any
+}
+
+type notifyCall struct {
+	method string
+	params any
+}
+
+func newRecordingNotifier() *recordingNotifier {
+	return &recordingNotifier{data: make(chan map[string]any, 64)}
+}
+
+func (n *recordingNotifier) Notify(ctx context.Context, method string, params any) error {
+	n.mu.Lock()
+	n.calls = append(n.calls, notifyCall{method: method, params: params})
+	n.mu.Unlock()
+	if method == "proxy.data" {
+		if m, ok := params.(map[string]any); ok {
+			n.data <- m
+		}
+	}
+	return nil
+}
+
+// startEchoServer starts a TCP server that echoes back whatever it reads,
+// returning its address. It is closed automatically at test cleanup.
+func startEchoServer(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen echo server: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go io.Copy(conn, conn)
+		}
+	}()
+	return ln.Addr().String()
+}
+
+// startHTTPConnectProxy starts a minimal HTTP CONNECT proxy that tunnels
+// to whatever target the client requests, returning its address.
+func startHTTPConnectProxy(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen http connect proxy: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serveHTTPConnect(conn)
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func serveHTTPConnect(client net.Conn) {
+	defer client.Close()
+	br := bufio.NewReader(client)
+	tp := textproto.NewReader(br)
+	requestLine, err := tp.ReadLine()
+	if err != nil {
+		return
+	}
+	if _, err := tp.ReadMIMEHeader(); err != nil {
+		return
+	}
+
+	var method, target string
+	if _, err := fmt.Sscanf(requestLine, "%s %s", &method, &target); err != nil || method != "CONNECT" {
+		fmt.Fprint(client, "HTTP/1.1 400 Bad Request\r\n\r\n")
+		return
+	}
+
+	upstream, err := net.Dial("tcp", target)
+	if err != nil {
+		fmt.Fprint(client, "HTTP/1.1 502 Bad Gateway\r\n\r\n")
+		return
+	}
+	defer upstream.Close()
+
+	fmt.Fprint(client, "HTTP/1.1 200 Connection Established\r\n\r\n")
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() { defer wg.Done(); io.Copy(upstream, br) }()
+	go func() { defer wg.Done(); io.Copy(client, upstream) }()
+	wg.Wait()
+}
+
+// startSOCKS5Proxy starts a minimal no-auth RFC1928 SOCKS5 proxy,
+// returning its address.
+func startSOCKS5Proxy(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen socks5 proxy: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serveSOCKS5(conn)
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func serveSOCKS5(client net.Conn) {
+	defer client.Close()
+
+	header := make([]byte, 2)
+	if _, err := readFull(client, header); err != nil || header[0] != socks5Version {
+		return
+	}
+	methods := make([]byte, header[1])
+	if _, err := readFull(client, methods); err != nil {
+		return
+	}
+	if _, err := client.Write([]byte{socks5Version, authNone}); err != nil {
+		return
+	}
+
+	req := make([]byte, 4)
+	if _, err := readFull(client, req); err != nil || req[1] != cmdConnect {
+		return
+	}
+
+	var target string
+	switch req[3] {
+	case addrIPv4:
+		addr := make([]byte, net.IPv4len+2)
+		if _, err := readFull(client, addr); err != nil {
+			return
+		}
+		port := uint16(addr[4])<<8 | uint16(addr[5])
+		target = fmt.Sprintf("%s:%d", net.IP(addr[:4]).String(), port)
+	case addrDomain:
+		lenByte := make([]byte, 1)
+		if _, err := readFull(client, lenByte); err != nil {
+			return
+		}
+		rest := make([]byte, int(lenByte[0])+2)
+		if _, err := readFull(client, rest); err != nil {
+			return
+		}
+		host := string(rest[:lenByte[0]])
+		port := uint16(rest[len(rest)-2])<<8 | uint16(rest[len(rest)-1])
+		target = fmt.Sprintf("%s:%d", host, port)
+	default:
+		return
+	}
+
+	upstream, err := net.Dial("tcp", target)
+	if err != nil {
+		client.Write([]byte{socks5Version, 0x01, 0x00, addrIPv4, 0, 0, 0, 0, 0, 0})
+		return
+	}
+	defer upstream.Close()
+
+	client.Write([]byte{socks5Version, replySucceeded, 0x00, addrIPv4, 0, 0, 0, 0, 0, 0})
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() { defer wg.Done(); io.Copy(upstream, client) }()
+	go func() { defer wg.Done(); io.Copy(client, upstream) }()
+	wg.Wait()
+}
+
+func TestProxyHTTPConnectRoundTrip(t *testing.T) {
+	echoAddr := startEchoServer(t)
+	proxyAddr := startHTTPConnectProxy(t)
+
+	notifier := newRecordingNotifier()
+	mgr := NewManager(Config{HTTPConnectUpstream: proxyAddr}, notifier)
+
+	openResult, err := mgr.handleOpen(context.Background(), &jsonrpc2.Request{
+		Params: mustParams(t, map[string]any{"protocol": "http_connect", "target": echoAddr}),
+	})
+	if err != nil {
+		t.Fatalf("proxy.open: %v", err)
+	}
+	streamID := openResult.(map[string]any)["stream_id"].(string)
+
+	payload := "hello through http connect"
+	if _, err := mgr.handleWrite(context.Background(), &jsonrpc2.Request{
+		Params: mustParams(t, map[string]any{
+			"stream_id": streamID,
+			"data":      base64.StdEncoding.EncodeToString([]byte(payload)),
+		}),
+	}); err != nil {
+		t.Fatalf("proxy.write: %v", err)
+	}
+
+	select {
+	case chunk := <-notifier.data:
+		data, _ := chunk["data"].(string)
+		decoded, err := base64.StdEncoding.DecodeString(data)
+		if err != nil {
+			t.Fatalf("decode pushed chunk: %v", err)
+		}
+		if string(decoded) != payload {
+			t.Fatalf("echoed payload = %q, want %q", decoded, payload)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for proxy.data notification")
+	}
+}
+
+func TestProxySOCKS5RoundTrip(t *testing.T) {
+	echoAddr := startEchoServer(t)
+	proxyAddr := startSOCKS5Proxy(t)
+
+	notifier := newRecordingNotifier()
+	mgr := NewManager(Config{SOCKS5Upstream: proxyAddr}, notifier)
+
+	openResult, err := mgr.handleOpen(context.Background(), &jsonrpc2.Request{
+		Params: mustParams(t, map[string]any{"protocol": "socks5", "target": echoAddr}),
+	})
+	if err != nil {
+		t.Fatalf("proxy.open: %v", err)
+	}
+	streamID := openResult.(map[string]any)["stream_id"].(string)
+
+	payload := "hello through socks5"
+	if _, err := mgr.handleWrite(context.Background(), &jsonrpc2.Request{
+		Params: mustParams(t, map[string]any{
+			"stream_id": streamID,
+			"data":      base64.StdEncoding.EncodeToString([]byte(payload)),
+		}),
+	}); err != nil {
+		t.Fatalf("proxy.write: %v", err)
+	}
+
+	select {
+	case chunk := <-notifier.data:
+		data, _ := chunk["data"].(string)
+		decoded, err := base64.StdEncoding.DecodeString(data)
+		if err != nil {
+			t.Fatalf("decode pushed chunk: %v", err)
+		}
+		if string(decoded) != payload {
+			t.Fatalf("echoed payload = %q, want %q", decoded, payload)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for proxy.data notification")
+	}
+}
+
+// TestProxyWindowUpdateReflectsOutstandingBufferedBytes covers the
+// window_update math directly: available must be derived from the bytes
+// still sitting in s.out, not just the size of the chunk pushLoop just
+// drained, so a client pacing its sends off window_update gets a number
+// that matches the stream's real backlog.
+func TestProxyWindowUpdateReflectsOutstandingBufferedBytes(t *testing.T) {
+	notifier := newRecordingNotifier()
+	mgr := NewManager(Config{WindowSize: 64 * 1024}, notifier)
+
+	s := newStream("stream-1", nil, mgr.cfg.WindowSize)
+	chunk1 := make([]byte, 20000)
+	chunk2 := make([]byte, 10000)
+	s.bufferedBytes.Add(int64(len(chunk1) + len(chunk2)))
+	s.out <- chunk1
+	s.out <- chunk2
+	close(s.out)
+
+	mgr.pushLoop(s)
+
+	notifier.mu.Lock()
+	var availables []int
+	for _, call := range notifier.calls {
+		if call.method != "proxy.window_update" {
+			continue
+		}
+		params, _ := call.params.(map[string]any)
+		avail, _ := params["available"].(int)
+		availables = append(availables, avail)
+	}
+	notifier.mu.Unlock()
+
+	if len(availables) != 2 {
+		t.Fatalf("got %d window_update calls, want 2: %v", len(availables), availables)
+	}
+	// After draining chunk1 (20000 bytes), chunk2 (10000 bytes) is still
+	// outstanding, so available should reflect that backlog, not
+	// WindowSize-len(chunk1).
+	if want := 64*1024 - 10000; availables[0] != want {
+		t.Fatalf("available after first drain = %d, want %d (64KiB minus the still-buffered 10000 bytes)", availables[0], want)
+	}
+	if want := 64 * 1024; availables[1] != want {
+		t.Fatalf("available after second drain = %d, want %d (buffer fully drained)", availables[1], want)
+	}
+}
+
+func mustParams(t *testing.T, v map[string]any) []byte {
+	t.Helper()
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatalf("marshal params: %v", err)
+	}
+	return data
+}
@@ -0,0 +1,189 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+)
+
+// SOCKS5 constants from RFC 1928 / RFC 1929.
+const (
+	socks5Version = 0x05
+
+	authNone     = 0x00
+	authUserPass = 0x02
+	authNoMethod = 0xFF
+
+	cmdConnect = 0x01
+
+	addrIPv4   = 0x01
+	addrDomain = 0x03
+	addrIPv6   = 0x04
+
+	replySucceeded = 0x00
+)
+
+// dialSOCKS5 opens target through the upstream SOCKS5 proxy, performing
+// method negotiation (no-auth or username/password) and the CONNECT
+// command, per RFC 1928.
+func dialSOCKS5(ctx context.Context, upstream, target string, auth *authParams) (net.Conn, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", upstream)
+	if err != nil {
+		return nil, fmt.Errorf("dial upstream %s: %w", upstream, err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+	ok := false
+	defer func() {
+		if !ok {
+			conn.Close()
+		}
+	}()
+
+	if err := socks5Negotiate(conn, auth); err != nil {
+		return nil, err
+	}
+	if err := socks5Connect(conn, target); err != nil {
+		return nil, err
+	}
+
+	_ = conn.SetDeadline(noDeadline)
+	ok = true
+	return conn, nil
+}
+
+func socks5Negotiate(conn net.Conn, auth *authParams) error {
+	methods := []byte{authNone}
+	if auth != nil && auth.Username != "" {
+		methods = []byte{authUserPass, authNone}
+	}
+
+	req := append([]byte{socks5Version, byte(len(methods))}, methods...)
+	if _, err := conn.Write(req); err != nil {
+		return fmt.Errorf("write method negotiation: %w", err)
+	}
+
+	resp := make([]byte, 2)
+	if _, err := readFull(conn, resp); err != nil {
+		return fmt.Errorf("read method negotiation: %w", err)
+	}
+	if resp[0] != socks5Version {
+		return fmt.Errorf("unexpected SOCKS version %d", resp[0])
+	}
+
+	switch resp[1] {
+	case authNone:
+		return nil
+	case authUserPass:
+		if auth == nil {
+			return fmt.Errorf("upstream requires username/password auth")
+		}
+		return socks5UserPassAuth(conn, auth)
+	case authNoMethod:
+		return fmt.Errorf("upstream rejected all authentication methods")
+	default:
+		return fmt.Errorf("unsupported auth method %d", resp[1])
+	}
+}
+
+func socks5UserPassAuth(conn net.Conn, auth *authParams) error {
+	if len(auth.Username) > 255 || len(auth.Password) > 255 {
+		return fmt.Errorf("username/password too long for SOCKS5 auth")
+	}
+	req := make([]byte, 0, 3+len(auth.Username)+len(auth.Password))
+	req = append(req, 0x01, byte(len(auth.Username)))
+	req = append(req, auth.Username...)
+	req = append(req, byte(len(auth.Password)))
+	req = append(req, auth.Password...)
+	if _, err := conn.Write(req); err != nil {
+		return fmt.Errorf("write auth: %w", err)
+	}
+	resp := make([]byte, 2)
+	if _, err := readFull(conn, resp); err != nil {
+		return fmt.Errorf("read auth response: %w", err)
+	}
+	if resp[1] != 0x00 {
+		return fmt.Errorf("upstream rejected username/password auth")
+	}
+	return nil
+}
+
+func socks5Connect(conn net.Conn, target string) error {
+	host, portStr, err := net.SplitHostPort(target)
+	if err != nil {
+		return fmt.Errorf("invalid target %q: %w", target, err)
+	}
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil {
+		return fmt.Errorf("invalid port in target %q: %w", target, err)
+	}
+
+	req := []byte{socks5Version, cmdConnect, 0x00}
+	req = append(req, encodeSOCKS5Addr(host)...)
+	req = append(req, byte(port>>8), byte(port))
+	if _, err := conn.Write(req); err != nil {
+		return fmt.Errorf("write connect request: %w", err)
+	}
+
+	header := make([]byte, 4)
+	if _, err := readFull(conn, header); err != nil {
+		return fmt.Errorf("read connect reply: %w", err)
+	}
+	if header[0] != socks5Version {
+		return fmt.Errorf("unexpected SOCKS version %d in reply", header[0])
+	}
+	if header[1] != replySucceeded {
+		return fmt.Errorf("SOCKS5 CONNECT failed with reply code %d", header[1])
+	}
+
+	var addrLen int
+	switch header[3] {
+	case addrIPv4:
+		addrLen = net.IPv4len
+	case addrIPv6:
+		addrLen = net.IPv6len
+	case addrDomain:
+		lenByte := make([]byte, 1)
+		if _, err := readFull(conn, lenByte); err != nil {
+			return fmt.Errorf("read bound domain length: %w", err)
+		}
+		addrLen = int(lenByte[0])
+	default:
+		return fmt.Errorf("unknown bound address type %d", header[3])
+	}
+	// Discard bound address + port; callers only need the tunnel.
+	if _, err := readFull(conn, make([]byte, addrLen+2)); err != nil {
+		return fmt.Errorf("read bound address: %w", err)
+	}
+	return nil
+}
+
+// encodeSOCKS5Addr encodes host as a SOCKS5 address (IPv4, IPv6, or
+// domain name), per RFC 1928 section 5.
+func encodeSOCKS5Addr(host string) []byte {
+	if ip := net.ParseIP(host); ip != nil {
+		if ip4 := ip.To4(); ip4 != nil {
+			return append([]byte{addrIPv4}, ip4...)
+		}
+		return append([]byte{addrIPv6}, ip.To16()...)
+	}
+	b := make([]byte, 0, 2+len(host))
+	b = append(b, addrDomain, byte(len(host)))
+	b = append(b, host...)
+	return b
+}
+
+func readFull(conn net.Conn, buf []byte) (int, error) {
+	total := 0
+	for total < len(buf) {
+		n, err := conn.Read(buf[total:])
+		total += n
+		if err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
@@ -0,0 +1,34 @@
+package proxy
+
+import (
+	"net"
+	"sync/atomic"
+)
+
+// stream is one open proxy.open'd connection.
+type stream struct {
+	id   string
+	conn net.Conn
+	// out buffers chunks read from conn. Its capacity bounds the number of
+	// chunks (and therefore roughly windowSize bytes, given the pump's
+	// 32KiB read buffer) that may be in flight before pump's blocking send
+	// applies backpressure.
+	out chan []byte
+
+	// windowSize is the byte cap bufferedBytes is measured against, for
+	// reporting proxy.window_update's available field.
+	windowSize int
+	// bufferedBytes is the number of bytes pump has sent into out that
+	// neither pushLoop nor proxy.read has drained yet, i.e. the stream's
+	// actual outstanding buffered data. It, not a per-chunk guess, is what window_update's
+	// available field is computed from.
+	bufferedBytes atomic.Int64
+}
+
+func newStream(id string, conn net.Conn, windowSize int) *stream {
+	capacity := windowSize / (32 * 1024)
+	if capacity < 1 {
+		capacity = 1
+	}
+	return &stream{id: id, conn: conn, out: make(chan []byte, capacity), windowSize: windowSize}
+}
@@ -0,0 +1,127 @@
+package session
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+
+	"github.com/creack/pty"
+)
+
+// session is one open session.open'd command.
+type session struct {
+	id  string
+	cmd *exec.Cmd
+
+	// ptmx is non-nil when the session was opened with pty; stdin and the
+	// combined stdout/stderr stream are both served through it. Otherwise
+	// stdin is a plain os/exec stdin pipe and stdout/stderr are read from
+	// separate pipes.
+	ptmx  *os.File
+	stdin io.WriteCloser
+
+	// output buffers chunks read from the child's stdout/stderr. Its
+	// capacity bounds the number of chunks (and therefore roughly
+	// outputBufferSize bytes, given the pump's 32KiB read buffer) that may
+	// be in flight before the pump's blocking send applies backpressure,
+	// mirroring proxy.stream's window-bounded channel so a client that
+	// stops draining session.output can't grow a session's buffered
+	// output without bound.
+	output chan outputChunk
+}
+
+// outputChunk is one buffered read from a session's stdout or stderr.
+type outputChunk struct {
+	stream string // "stdout" or "stderr"
+	data   []byte
+}
+
+func newSession(id string, cmd *exec.Cmd, outputBufferSize int) *session {
+	capacity := outputBufferSize / (32 * 1024)
+	if capacity < 1 {
+		capacity = 1
+	}
+	return &session{id: id, cmd: cmd, output: make(chan outputChunk, capacity)}
+}
+
+// pumpOutput reads from r until it returns an error (including io.EOF on
+// a clean close) and buffers each chunk into s.output, tagged with
+// stream. It does not close s.output; the caller does once every pump
+// reading into a given session has returned.
+func (s *session) pumpOutput(stream string, r io.Reader) {
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			chunk := append([]byte(nil), buf[:n]...)
+			s.output <- outputChunk{stream: stream, data: chunk}
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// exitInfo decodes the error cmd.Wait returns into the (code, signal)
+// pair reported by session.exit: a normal exit reports its status code
+// and no signal; a signal death reports code -1 and the signal's name.
+func exitInfo(err error) (code int, signal string) {
+	if err == nil {
+		return 0, ""
+	}
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		return -1, ""
+	}
+	status, ok := exitErr.Sys().(syscall.WaitStatus)
+	if !ok {
+		return exitErr.ExitCode(), ""
+	}
+	if status.Signaled() {
+		return -1, signalName(status.Signal())
+	}
+	return status.ExitStatus(), ""
+}
+
+// signalsByName maps the POSIX names session.signal accepts to their
+// syscall.Signal value.
+var signalsByName = map[string]syscall.Signal{
+	"SIGHUP":   syscall.SIGHUP,
+	"SIGINT":   syscall.SIGINT,
+	"SIGQUIT":  syscall.SIGQUIT,
+	"SIGKILL":  syscall.SIGKILL,
+	"SIGTERM":  syscall.SIGTERM,
+	"SIGUSR1":  syscall.SIGUSR1,
+	"SIGUSR2":  syscall.SIGUSR2,
+	"SIGCONT":  syscall.SIGCONT,
+	"SIGSTOP":  syscall.SIGSTOP,
+	"SIGWINCH": syscall.SIGWINCH,
+}
+
+func parseSignal(name string) (syscall.Signal, error) {
+	sig, ok := signalsByName[strings.ToUpper(name)]
+	if !ok {
+		return 0, fmt.Errorf("unknown signal %q", name)
+	}
+	return sig, nil
+}
+
+func signalName(sig syscall.Signal) string {
+	for name, s := range signalsByName {
+		if s == sig {
+			return name
+		}
+	}
+	return sig.String()
+}
+
+// startPTY starts cmd attached to a new pty sized cols x rows, returning
+// the master end. It mirrors pty.StartWithSize's normal contract: cmd is
+// started as a side effect.
+func startPTY(cmd *exec.Cmd, cols, rows int) (*os.File, error) {
+	return pty.StartWithSize(cmd, &pty.Winsize{Cols: uint16(cols), Rows: uint16(rows)})
+}
@@ -0,0 +1,298 @@
+// Package session backs the session.basic capability advertised by
+// cmuxd-remote's hello response: it runs a command per session.open,
+// either under a pty or plain os/exec pipes, and shuttles stdin/stdout/
+// stderr between the child process and the jsonrpc2 client that opened
+// it.
+package session
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"sync"
+	"sync/atomic"
+
+	"github.com/creack/pty"
+
+	"github.com/manaflow-ai/cmux/daemon/remote/jsonrpc2"
+)
+
+// defaultOutputBufferSize is the number of unread output bytes the
+// manager will buffer per session before the pump blocks, waiting for
+// the push loop to catch up.
+const defaultOutputBufferSize = 256 * 1024
+
+// Config configures the session subsystem.
+type Config struct {
+	// OutputBufferSize caps the bytes buffered per session between the
+	// child's stdout/stderr and the session.output notifications pushed
+	// to the client. Defaults to 256KiB.
+	OutputBufferSize int
+}
+
+// Notifier is the subset of *jsonrpc2.Conn the manager needs in order to
+// push server-initiated notifications (session.output, session.exit).
+type Notifier interface {
+	Notify(ctx context.Context, method string, params any) error
+}
+
+// Manager implements the session.* RPC methods and owns all open
+// sessions.
+type Manager struct {
+	cfg    Config
+	notify Notifier
+
+	nextID atomic.Int64
+
+	mu       sync.Mutex
+	sessions map[string]*session
+}
+
+// NewManager constructs a Manager that pushes notifications via notify.
+func NewManager(cfg Config, notify Notifier) *Manager {
+	if cfg.OutputBufferSize <= 0 {
+		cfg.OutputBufferSize = defaultOutputBufferSize
+	}
+	return &Manager{cfg: cfg, notify: notify, sessions: make(map[string]*session)}
+}
+
+// Register binds the session.* methods onto mux.
+func (m *Manager) Register(mux *jsonrpc2.Mux) {
+	mux.RegisterFunc("session.open", m.handleOpen)
+	mux.RegisterFunc("session.write", m.handleWrite)
+	mux.RegisterFunc("session.resize", m.handleResize)
+	mux.RegisterFunc("session.signal", m.handleSignal)
+	mux.RegisterFunc("session.close", m.handleClose)
+}
+
+type ptyParams struct {
+	Cols int `json:"cols"`
+	Rows int `json:"rows"`
+}
+
+type openParams struct {
+	Command []string          `json:"command"`
+	Env     map[string]string `json:"env,omitempty"`
+	Cwd     string            `json:"cwd,omitempty"`
+	PTY     *ptyParams        `json:"pty,omitempty"`
+}
+
+func (m *Manager) handleOpen(ctx context.Context, req *jsonrpc2.Request) (any, error) {
+	var params openParams
+	if err := unmarshalParams(req, &params); err != nil {
+		return nil, err
+	}
+	if len(params.Command) == 0 {
+		return nil, jsonrpc2.NewError(jsonrpc2.CodeInvalidParams, "command is required")
+	}
+
+	cmd := exec.Command(params.Command[0], params.Command[1:]...)
+	cmd.Dir = params.Cwd
+	if len(params.Env) > 0 {
+		env := os.Environ()
+		for k, v := range params.Env {
+			env = append(env, k+"="+v)
+		}
+		cmd.Env = env
+	}
+
+	id := fmt.Sprintf("session-%d", m.nextID.Add(1))
+	s := newSession(id, cmd, m.cfg.OutputBufferSize)
+
+	if params.PTY != nil {
+		ptmx, err := startPTY(cmd, params.PTY.Cols, params.PTY.Rows)
+		if err != nil {
+			return nil, jsonrpc2.NewError(jsonrpc2.CodeInternalError, "start pty: "+err.Error())
+		}
+		s.ptmx = ptmx
+		s.stdin = ptmx
+		go func() {
+			s.pumpOutput("stdout", ptmx)
+			close(s.output)
+		}()
+	} else {
+		stdin, err := cmd.StdinPipe()
+		if err != nil {
+			return nil, jsonrpc2.NewError(jsonrpc2.CodeInternalError, "stdin pipe: "+err.Error())
+		}
+		stdout, err := cmd.StdoutPipe()
+		if err != nil {
+			return nil, jsonrpc2.NewError(jsonrpc2.CodeInternalError, "stdout pipe: "+err.Error())
+		}
+		stderr, err := cmd.StderrPipe()
+		if err != nil {
+			return nil, jsonrpc2.NewError(jsonrpc2.CodeInternalError, "stderr pipe: "+err.Error())
+		}
+		if err := cmd.Start(); err != nil {
+			return nil, jsonrpc2.NewError(jsonrpc2.CodeInternalError, "start: "+err.Error())
+		}
+		s.stdin = stdin
+		go func() {
+			var wg sync.WaitGroup
+			wg.Add(2)
+			go func() { defer wg.Done(); s.pumpOutput("stdout", stdout) }()
+			go func() { defer wg.Done(); s.pumpOutput("stderr", stderr) }()
+			wg.Wait()
+			close(s.output)
+		}()
+	}
+
+	m.mu.Lock()
+	m.sessions[id] = s
+	m.mu.Unlock()
+
+	go m.pushLoop(s)
+
+	return map[string]any{"session_id": id}, nil
+}
+
+type writeParams struct {
+	SessionID string `json:"session_id"`
+	Data      string `json:"data"`
+}
+
+func (m *Manager) handleWrite(ctx context.Context, req *jsonrpc2.Request) (any, error) {
+	var params writeParams
+	if err := unmarshalParams(req, &params); err != nil {
+		return nil, err
+	}
+	s, err := m.lookup(params.SessionID)
+	if err != nil {
+		return nil, err
+	}
+	data, err := base64.StdEncoding.DecodeString(params.Data)
+	if err != nil {
+		return nil, jsonrpc2.NewError(jsonrpc2.CodeInvalidParams, "data must be base64: "+err.Error())
+	}
+	n, err := s.stdin.Write(data)
+	if err != nil {
+		return nil, jsonrpc2.NewError(jsonrpc2.CodeInternalError, "write: "+err.Error())
+	}
+	return map[string]any{"written": n}, nil
+}
+
+type resizeParams struct {
+	SessionID string `json:"session_id"`
+	Cols      int    `json:"cols"`
+	Rows      int    `json:"rows"`
+}
+
+func (m *Manager) handleResize(ctx context.Context, req *jsonrpc2.Request) (any, error) {
+	var params resizeParams
+	if err := unmarshalParams(req, &params); err != nil {
+		return nil, err
+	}
+	s, err := m.lookup(params.SessionID)
+	if err != nil {
+		return nil, err
+	}
+	if s.ptmx == nil {
+		return nil, jsonrpc2.NewError(jsonrpc2.CodeInvalidParams, "session was not opened with pty")
+	}
+	if err := pty.Setsize(s.ptmx, &pty.Winsize{Cols: uint16(params.Cols), Rows: uint16(params.Rows)}); err != nil {
+		return nil, jsonrpc2.NewError(jsonrpc2.CodeInternalError, "resize: "+err.Error())
+	}
+	return map[string]any{"resized": true}, nil
+}
+
+type signalParams struct {
+	SessionID string `json:"session_id"`
+	Signal    string `json:"signal"`
+}
+
+func (m *Manager) handleSignal(ctx context.Context, req *jsonrpc2.Request) (any, error) {
+	var params signalParams
+	if err := unmarshalParams(req, &params); err != nil {
+		return nil, err
+	}
+	s, err := m.lookup(params.SessionID)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := parseSignal(params.Signal)
+	if err != nil {
+		return nil, jsonrpc2.NewError(jsonrpc2.CodeInvalidParams, err.Error())
+	}
+	if s.cmd.Process == nil {
+		return nil, jsonrpc2.NewError(jsonrpc2.CodeInternalError, "process has not started")
+	}
+	if err := s.cmd.Process.Signal(sig); err != nil {
+		return nil, jsonrpc2.NewError(jsonrpc2.CodeInternalError, "signal: "+err.Error())
+	}
+	return map[string]any{"signaled": true}, nil
+}
+
+type sessionParams struct {
+	SessionID string `json:"session_id"`
+}
+
+func (m *Manager) handleClose(ctx context.Context, req *jsonrpc2.Request) (any, error) {
+	var params sessionParams
+	if err := unmarshalParams(req, &params); err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	s, ok := m.sessions[params.SessionID]
+	delete(m.sessions, params.SessionID)
+	m.mu.Unlock()
+	if !ok {
+		return nil, jsonrpc2.NewError(jsonrpc2.CodeInvalidParams, fmt.Sprintf("unknown session_id %q", params.SessionID))
+	}
+	if s.cmd.Process != nil {
+		_ = s.cmd.Process.Kill()
+	}
+	if s.ptmx != nil {
+		_ = s.ptmx.Close()
+	}
+	return map[string]any{"closed": true}, nil
+}
+
+func (m *Manager) lookup(id string) (*session, error) {
+	m.mu.Lock()
+	s, ok := m.sessions[id]
+	m.mu.Unlock()
+	if !ok {
+		return nil, jsonrpc2.NewError(jsonrpc2.CodeInvalidParams, fmt.Sprintf("unknown session_id %q", id))
+	}
+	return s, nil
+}
+
+// pushLoop drains s.output and forwards each chunk to the client as a
+// session.output notification. Once every pump feeding s.output has
+// finished (meaning the child's stdout/stderr are both at EOF) it waits
+// for the process to exit and pushes session.exit, so a client always
+// sees a session's output before its exit notification.
+func (m *Manager) pushLoop(s *session) {
+	for chunk := range s.output {
+		_ = m.notify.Notify(context.Background(), "session.output", map[string]any{
+			"session_id": s.id,
+			"stream":     chunk.stream,
+			"data":       base64.StdEncoding.EncodeToString(chunk.data),
+		})
+	}
+
+	code, signal := exitInfo(s.cmd.Wait())
+
+	m.mu.Lock()
+	delete(m.sessions, s.id)
+	m.mu.Unlock()
+
+	_ = m.notify.Notify(context.Background(), "session.exit", map[string]any{
+		"session_id": s.id,
+		"code":       code,
+		"signal":     signal,
+	})
+}
+
+func unmarshalParams(req *jsonrpc2.Request, dst any) error {
+	if len(req.Params) == 0 {
+		return jsonrpc2.NewError(jsonrpc2.CodeInvalidParams, "params are required")
+	}
+	if err := json.Unmarshal(req.Params, dst); err != nil {
+		return jsonrpc2.NewError(jsonrpc2.CodeInvalidParams, "invalid params: "+err.Error())
+	}
+	return nil
+}
@@ -0,0 +1,192 @@
+package session
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/manaflow-ai/cmux/daemon/remote/jsonrpc2"
+)
+
+// recordingNotifier captures every Notify call, in order, so tests can
+// assert on the session.output/session.exit sequence the manager pushes.
+type recordingNotifier struct {
+	mu    sync.Mutex
+	calls []notifyCall
+	ch    chan notifyCall
+}
+
+type notifyCall struct {
+	method string
+	params map[string]any
+}
+
+func newRecordingNotifier() *recordingNotifier {
+	return &recordingNotifier{ch: make(chan notifyCall, 64)}
+}
+
+func (n *recordingNotifier) Notify(ctx context.Context, method string, params any) error {
+	m, _ := params.(map[string]any)
+	n.mu.Lock()
+	n.calls = append(n.calls, notifyCall{method: method, params: m})
+	n.mu.Unlock()
+	n.ch <- notifyCall{method: method, params: m}
+	return nil
+}
+
+func TestSessionOpenRunsCommandAndPushesOrderedNotifications(t *testing.T) {
+	notifier := newRecordingNotifier()
+	mgr := NewManager(Config{}, notifier)
+
+	openResult, err := mgr.handleOpen(context.Background(), &jsonrpc2.Request{
+		Params: mustParams(t, map[string]any{
+			"command": []string{"/bin/sh", "-c", "echo hi; exit 3"},
+		}),
+	})
+	if err != nil {
+		t.Fatalf("session.open: %v", err)
+	}
+	sessionID := openResult.(map[string]any)["session_id"].(string)
+
+	var output []byte
+	var exit notifyCall
+	deadline := time.After(5 * time.Second)
+	for {
+		select {
+		case call := <-notifier.ch:
+			switch call.method {
+			case "session.output":
+				if call.params["session_id"] != sessionID {
+					t.Fatalf("session.output for unexpected session_id: %v", call.params)
+				}
+				data, _ := call.params["data"].(string)
+				decoded, err := base64.StdEncoding.DecodeString(data)
+				if err != nil {
+					t.Fatalf("decode session.output data: %v", err)
+				}
+				output = append(output, decoded...)
+			case "session.exit":
+				exit = call
+			}
+		case <-deadline:
+			t.Fatal("timed out waiting for session.exit")
+		}
+		if exit.method == "session.exit" {
+			break
+		}
+	}
+
+	if string(output) != "hi\n" {
+		t.Fatalf("output = %q, want %q", output, "hi\n")
+	}
+	if code, _ := exit.params["code"].(int); code != 3 {
+		t.Fatalf("exit code = %v, want 3: %v", exit.params["code"], exit.params)
+	}
+
+	// session.exit must be the last notification: every session.output
+	// call preceding it in notifier.calls, none after.
+	notifier.mu.Lock()
+	defer notifier.mu.Unlock()
+	sawExit := false
+	for _, call := range notifier.calls {
+		if call.method == "session.exit" {
+			sawExit = true
+			continue
+		}
+		if sawExit {
+			t.Fatalf("got %s notification after session.exit: %v", call.method, notifier.calls)
+		}
+	}
+}
+
+func TestSessionWriteEchoesThroughPTY(t *testing.T) {
+	notifier := newRecordingNotifier()
+	mgr := NewManager(Config{}, notifier)
+
+	openResult, err := mgr.handleOpen(context.Background(), &jsonrpc2.Request{
+		Params: mustParams(t, map[string]any{
+			"command": []string{"/bin/cat"},
+			"pty":     map[string]any{"cols": 80, "rows": 24},
+		}),
+	})
+	if err != nil {
+		t.Fatalf("session.open: %v", err)
+	}
+	sessionID := openResult.(map[string]any)["session_id"].(string)
+
+	if _, err := mgr.handleWrite(context.Background(), &jsonrpc2.Request{
+		Params: mustParams(t, map[string]any{
+			"session_id": sessionID,
+			"data":       base64.StdEncoding.EncodeToString([]byte("hello\n")),
+		}),
+	}); err != nil {
+		t.Fatalf("session.write: %v", err)
+	}
+
+	var output []byte
+	deadline := time.After(5 * time.Second)
+	for !strings.Contains(string(output), "hello\r\n") {
+		select {
+		case call := <-notifier.ch:
+			if call.method != "session.output" {
+				continue
+			}
+			data, _ := call.params["data"].(string)
+			decoded, err := base64.StdEncoding.DecodeString(data)
+			if err != nil {
+				t.Fatalf("decode session.output data: %v", err)
+			}
+			output = append(output, decoded...)
+		case <-deadline:
+			t.Fatalf("timed out waiting for echoed output, got %q so far", output)
+		}
+	}
+
+	if _, err := mgr.handleClose(context.Background(), &jsonrpc2.Request{
+		Params: mustParams(t, map[string]any{"session_id": sessionID}),
+	}); err != nil {
+		t.Fatalf("session.close: %v", err)
+	}
+}
+
+func TestSessionSignalUnknownNameIsInvalidParams(t *testing.T) {
+	notifier := newRecordingNotifier()
+	mgr := NewManager(Config{}, notifier)
+
+	openResult, err := mgr.handleOpen(context.Background(), &jsonrpc2.Request{
+		Params: mustParams(t, map[string]any{"command": []string{"/bin/sleep", "5"}}),
+	})
+	if err != nil {
+		t.Fatalf("session.open: %v", err)
+	}
+	sessionID := openResult.(map[string]any)["session_id"].(string)
+	t.Cleanup(func() {
+		_, _ = mgr.handleClose(context.Background(), &jsonrpc2.Request{
+			Params: mustParams(t, map[string]any{"session_id": sessionID}),
+		})
+	})
+
+	_, err = mgr.handleSignal(context.Background(), &jsonrpc2.Request{
+		Params: mustParams(t, map[string]any{"session_id": sessionID, "signal": "SIGBOGUS"}),
+	})
+	if err == nil {
+		t.Fatal("expected an error for an unknown signal name")
+	}
+	rerr, ok := err.(*jsonrpc2.Error)
+	if !ok || rerr.Code != jsonrpc2.CodeInvalidParams {
+		t.Fatalf("got error %v, want CodeInvalidParams", err)
+	}
+}
+
+func mustParams(t *testing.T, v map[string]any) []byte {
+	t.Helper()
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatalf("marshal params: %v", err)
+	}
+	return data
+}